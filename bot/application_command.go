@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// minIndexValue is the minimum value of the index options
+var minIndexValue = 1.0
+
+// dmPermission disables the application commands in direct messages
+var dmPermission = false
+
+// maxDescriptionLength is the maximum length of the description of application commands
+const maxDescriptionLength = 100
+
+// applicationCommandDefinition converts a Command to an application command
+func applicationCommandDefinition(command *Command) *discordgo.ApplicationCommand {
+	definition := &discordgo.ApplicationCommand{
+		Name:         command.Name,
+		Description:  command.Help,
+		DMPermission: &dmPermission,
+		Options:      make([]*discordgo.ApplicationCommandOption, len(command.Args)),
+	}
+	// Discord limits the length of descriptions
+	if len(definition.Description) > maxDescriptionLength {
+		definition.Description = definition.Description[:maxDescriptionLength-3] + "..."
+	}
+	if command.Permissions != 0 {
+		permissions := command.Permissions
+		definition.DefaultMemberPermissions = &permissions
+	}
+	for i, arg := range command.Args {
+		option := &discordgo.ApplicationCommandOption{
+			Type:         discordgo.ApplicationCommandOptionString,
+			Name:         arg.Name,
+			Description:  arg.Description,
+			Required:     arg.Required,
+			Autocomplete: arg.Autocomplete,
+		}
+		if arg.Type == argInteger {
+			option.Type = discordgo.ApplicationCommandOptionInteger
+			if arg.Positive {
+				option.MinValue = &minIndexValue
+			}
+		}
+		definition.Options[i] = option
+	}
+	return definition
+}
+
+// registerApplicationCommands registers all commands as global application commands
+// It overwrites the commands which are registered before
+func registerApplicationCommands(s *discordgo.Session) {
+	definitions := make([]*discordgo.ApplicationCommand, len(commands))
+	for i, command := range commands {
+		definitions[i] = applicationCommandDefinition(command)
+	}
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", definitions)
+	if err != nil {
+		log.Println("cannot register the application commands:", err)
+	}
+}
+
+// applicationCommandArgs converts the options of an application command to the arguments of a command
+func applicationCommandArgs(options []*discordgo.ApplicationCommandInteractionDataOption) commandArgs {
+	args := make(commandArgs, len(options))
+	for _, option := range options {
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionInteger:
+			args[option.Name] = strconv.FormatInt(option.IntValue(), 10)
+		default:
+			args[option.Name] = strings.TrimSpace(option.StringValue())
+		}
+	}
+	return args
+}
+
+func onInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+	data := i.ApplicationCommandData()
+	command := findCommand("", data.Name)
+	if command == nil {
+		return
+	}
+	// Commands only work in servers
+	if i.Member == nil || i.GuildID == "" {
+		_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{Content: "Use the commands in a server!"},
+		})
+		return
+	}
+	g, err := s.State.Guild(i.GuildID)
+	if err != nil {
+		log.Println("cannot get the guild:", err)
+		return
+	}
+	// The responses of owner only commands are not shown to others
+	var flags discordgo.MessageFlags
+	if command.OwnerOnly {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+	// Some commands might take longer than the interaction deadline. So we defer the response
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: flags},
+	})
+	if err != nil {
+		log.Println("cannot respond to interaction:", err)
+		return
+	}
+	// Validate the options. Discord validates them as well but the type of commands might be outdated
+	args := applicationCommandArgs(data.Options)
+	if err = command.validateArgs(args); err != nil {
+		_, _ = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{Content: "Invalid arguments: " + err.Error(), Flags: flags})
+		return
+	}
+	// Run the command
+	replied := false
+	executeCommand(commandContext{
+		session:     s,
+		guild:       g,
+		channelID:   i.ChannelID,
+		userID:      i.Member.User.ID,
+		permissions: i.Member.Permissions,
+		reply: func(content string) (*discordgo.Message, error) {
+			replied = true
+			return s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{Content: content, Flags: flags})
+		},
+	}, command, args)
+	// Every interaction must be answered
+	if !replied {
+		ack := command.Ack
+		if ack == "" {
+			ack = "Done"
+		}
+		_, _ = s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{Content: ack, Flags: flags})
+	}
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/config"
+	"Deemix-Discord-Bot/deezer"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ownerID is the discord user ID of the owner of bot application
+// It's empty if the owner is not known
+var ownerID string
+
+// setupDeemixConfig creates the deemix config directory of this bot and writes the ARL of config in it
+// The ARL is checked and the result is logged
+func setupDeemixConfig() {
+	directory, err := os.MkdirTemp("", "deemix-config*")
+	if err != nil {
+		log.Fatalln("Cannot create the deemix config directory:", err)
+	}
+	deemixConfig, err = deezer.NewDeemixConfig(directory)
+	if err != nil {
+		log.Fatalln("Cannot create the deemix config directory:", err)
+	}
+	arls.arls = configArls()
+	if len(arls.arls) == 0 {
+		log.Println("The deezer ARL is not set in config. deemix's own config is used to log in to deezer")
+		return
+	}
+	if err = deemixConfig.SetArl(arls.arls[0]); err != nil {
+		log.Fatalln("Cannot write the deezer ARL:", err)
+	}
+	name, err := arls.useValid()
+	switch err {
+	case nil:
+		log.Println("Logged in to deezer as", name)
+	case deezer.InvalidArlError:
+		log.Println("The deezer ARLs are invalid or expired. The downloads will fail until one of them is replaced with the arl command")
+	default:
+		log.Println("Cannot check the deezer ARL:", err)
+	}
+}
+
+// configArls returns the ARLs of config in the order which they are used
+func configArls() []string {
+	result := make([]string, 0, len(config.Config.Arls)+1)
+	for _, arl := range append([]string{config.Config.Arl}, config.Config.Arls...) {
+		if arl = strings.TrimSpace(arl); arl != "" {
+			result = append(result, arl)
+		}
+	}
+	return result
+}
+
+// arlList contains the ARLs which deemix uses one after another
+// The current ARL is used until it expires.
+type arlList struct {
+	arls []string
+	// The index of ARL which deemix uses
+	current int
+	mu      sync.Mutex
+}
+
+// arls are the ARLs of bot
+var arls arlList
+
+// useValid finds the first valid ARL from the current one and makes deemix use it
+// The expired ARLs are skipped. If an ARL cannot be checked, it's used anyway.
+// InvalidArlError is returned if all of them are expired.
+func (l *arlList) useValid() (name string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.arls) == 0 {
+		return "", deezer.InvalidArlError
+	}
+	for tried := 0; tried < len(l.arls); tried++ {
+		name, err = deezerClient.ValidateArl(l.arls[l.current])
+		if err != deezer.InvalidArlError {
+			break
+		}
+		l.current = (l.current + 1) % len(l.arls)
+	}
+	if writeErr := deemixConfig.SetArl(l.arls[l.current]); writeErr != nil {
+		return "", writeErr
+	}
+	return name, err
+}
+
+// rotate switches to the next valid ARL after a download failed because the current one is expired
+// It returns false if no other ARL can be used.
+func (l *arlList) rotate() bool {
+	name, err := l.useValid()
+	if err != nil {
+		log.Println("cannot switch to another deezer ARL:", err)
+		return false
+	}
+	log.Println("The deezer ARL is expired. Logged in to deezer as", name)
+	return true
+}
+
+// replace makes deemix use an ARL instead of the current one
+func (l *arlList) replace(arl string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := deemixConfig.SetArl(arl); err != nil {
+		return err
+	}
+	if len(l.arls) == 0 {
+		l.arls = append(l.arls, arl)
+	} else {
+		l.arls[l.current] = arl
+	}
+	return nil
+}
+
+// loadOwner finds the owner of bot application
+// If the application belongs to a team, the owner of team is used
+func loadOwner(s *discordgo.Session) {
+	application, err := s.Application("@me")
+	if err != nil {
+		log.Println("Cannot get the owner of bot. The owner only commands are disabled:", err)
+		return
+	}
+	if application.Team != nil {
+		ownerID = application.Team.OwnerID
+	} else if application.Owner != nil {
+		ownerID = application.Owner.ID
+	}
+}
+
+func commandArl(ctx commandContext, args commandArgs) {
+	arl := args.String("arl")
+	name, err := deezerClient.ValidateArl(arl)
+	if err != nil {
+		_, _ = ctx.reply("Cannot use this ARL: " + err.Error())
+		return
+	}
+	if err = arls.replace(arl); err != nil {
+		log.Println("cannot write the deezer ARL:", err)
+		_, _ = ctx.reply("Cannot save the ARL")
+		return
+	}
+	log.Println("The deezer ARL is replaced. Logged in to deezer as", name)
+	_, _ = ctx.reply("The ARL is replaced. Logged in to deezer as " + name)
+}
+
+// deleteSecretCommand deletes the message of a prefix command which contains a secret like the ARL
+// It's deleted before checking who sent it, so the secret doesn't stay in chat even if the command is rejected.
+func deleteSecretCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if err := s.ChannelMessageDelete(m.ChannelID, m.ID); err != nil {
+		log.Println("cannot delete the secret command:", err)
+		_, _ = s.ChannelMessageSendReply(m.ChannelID, "Cannot delete your message and the secret is visible in this channel. "+
+			"Delete it yourself. If it's an ARL, log out of deezer to expire it and use the /arl command with the new one.", m.Reference())
+	}
+}
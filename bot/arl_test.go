@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestDeezer makes the bot use a fake deezer gateway which accepts the ARLs in valid
+// It returns the file which deemix reads the ARL from.
+func useTestDeezer(t *testing.T, valid ...string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("arl")
+		for _, arl := range valid {
+			if err == nil && cookie.Value == arl {
+				_, _ = w.Write([]byte(`{"results":{"USER":{"USER_ID":1,"BLOG_NAME":"` + arl + `"}}}`))
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"results":{"USER":{"USER_ID":0}}}`))
+	}))
+	t.Cleanup(server.Close)
+	oldClient, oldConfig := deezerClient, deemixConfig
+	t.Cleanup(func() {
+		deezerClient, deemixConfig = oldClient, oldConfig
+	})
+	deezerClient = deezer.NewClient()
+	deezerClient.GatewayURL = server.URL
+	directory := t.TempDir()
+	var err error
+	if deemixConfig, err = deezer.NewDeemixConfig(directory); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(directory, "deemix", ".arl")
+}
+
+// expectArl checks the ARL which deemix uses
+func expectArl(t *testing.T, path, expected string) {
+	t.Helper()
+	arl, err := os.ReadFile(path)
+	if err != nil || string(arl) != expected {
+		t.Fatalf("expected deemix to use %s, got %q %v", expected, arl, err)
+	}
+}
+
+func TestArlListRotation(t *testing.T) {
+	path := useTestDeezer(t, "third", "fourth")
+	list := arlList{arls: []string{"first", "second", "third", "fourth"}}
+	// The expired ARLs are skipped
+	name, err := list.useValid()
+	if err != nil || name != "third" {
+		t.Fatalf("expected third, got %s %v", name, err)
+	}
+	expectArl(t, path, "third")
+	// A valid ARL is kept, even if another download failed with it before the rotation
+	if !list.rotate() || list.current != 2 {
+		t.Fatalf("expected to keep the third ARL, got %d", list.current)
+	}
+	// The replaced ARL takes the place of the current one
+	if err = list.replace("fourth"); err != nil {
+		t.Fatal(err)
+	}
+	expectArl(t, path, "fourth")
+	if list.arls[2] != "fourth" {
+		t.Fatalf("unexpected ARLs %v", list.arls)
+	}
+}
+
+func TestArlListAllExpired(t *testing.T) {
+	useTestDeezer(t)
+	list := arlList{arls: []string{"first", "second"}}
+	if _, err := list.useValid(); err != deezer.InvalidArlError {
+		t.Fatalf("expected InvalidArlError, got %v", err)
+	}
+	if list.rotate() {
+		t.Fatal("rotated to an expired ARL")
+	}
+	if _, err := (&arlList{}).useValid(); err != deezer.InvalidArlError {
+		t.Fatalf("expected InvalidArlError without ARLs, got %v", err)
+	}
+}
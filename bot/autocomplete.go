@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"Deemix-Discord-Bot/util"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// autocompleteDebounce is the time which we wait for the user to stop typing before searching
+const autocompleteDebounce = 300 * time.Millisecond
+
+// autocompleteDeadline is the maximum time which we spend on an autocomplete interaction
+// Discord gives us three seconds to respond
+const autocompleteDeadline = 2500 * time.Millisecond
+
+// autocompleteMinQueryLength is the minimum length of query to search it
+const autocompleteMinQueryLength = 2
+
+// maxChoiceLength is the maximum length of name and value of a choice in discord
+const maxChoiceLength = 100
+
+// AutocompleteState contains the latest autocomplete request of each user
+// The suggestions are cached by the deezer client
+type AutocompleteState struct {
+	// The latest autocomplete request of each user
+	latest map[string]autocompleteRequest
+	// A counter to give each request an ID
+	counter uint64
+	mu      sync.Mutex
+}
+
+// autocompleteRequest is an autocomplete request of a user
+type autocompleteRequest struct {
+	id      uint64
+	started time.Time
+}
+
+// cleanupFinishedRequests forgets the users whose latest request is finished
+func (a *AutocompleteState) cleanupFinishedRequests() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now()
+		a.mu.Lock()
+		for userID, request := range a.latest {
+			if now.Sub(request.started) > autocompleteDeadline {
+				delete(a.latest, userID)
+			}
+		}
+		a.mu.Unlock()
+	}
+}
+
+// newRequest registers a new request for a user and returns its ID
+func (a *AutocompleteState) newRequest(userID string) uint64 {
+	a.mu.Lock()
+	a.counter++
+	id := a.counter
+	a.latest[userID] = autocompleteRequest{id: id, started: time.Now()}
+	a.mu.Unlock()
+	return id
+}
+
+// isLatest checks if a request is the latest request of a user
+func (a *AutocompleteState) isLatest(userID string, id uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.latest[userID].id == id
+}
+
+// Suggest gets the suggestions of a query which a user is typing
+// It waits for the user to stop typing before searching and gives up if the search takes too long
+func (a *AutocompleteState) Suggest(userID, query string) []*discordgo.ApplicationCommandOptionChoice {
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	// Links are played directly, so there is nothing to suggest for them
+	if len(query) < autocompleteMinQueryLength || util.IsUrl(query) {
+		return nil
+	}
+	if tracks, ok := deezerClient.CachedSearchTrack(query); ok {
+		return trackChoices(tracks)
+	}
+	// Wait to see if user types more
+	deadline := time.After(autocompleteDeadline - autocompleteDebounce)
+	id := a.newRequest(userID)
+	time.Sleep(autocompleteDebounce)
+	if !a.isLatest(userID, id) {
+		return nil
+	}
+	// Search deezer in background. The results are cached by the client even if they are late
+	result := make(chan []*discordgo.ApplicationCommandOptionChoice, 1)
+	go func() {
+		tracks, err := deezerClient.SearchTrack(query)
+		if err != nil {
+			log.Println("cannot search the deezer for autocomplete:", err)
+			result <- nil
+			return
+		}
+		result <- trackChoices(tracks)
+	}()
+	select {
+	case choices := <-result:
+		return choices
+	case <-deadline:
+		return nil
+	}
+}
+
+// trackChoices converts the searched tracks to autocomplete choices
+func trackChoices(tracks []deezer.SearchedTrack) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(tracks))
+	for _, track := range tracks {
+		// Discord rejects the values which are too long
+		if len(track.Link) > maxChoiceLength {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  trackChoiceName(track),
+			Value: track.Link,
+		})
+	}
+	return choices
+}
+
+// trackChoiceName creates the name of a searched track to show in autocomplete
+// The format is "Artist - Title (m:ss)"
+func trackChoiceName(track deezer.SearchedTrack) string {
+	duration := " (" + track.FormatDuration() + ")"
+	name := []rune(track.String())
+	if maxNameLength := maxChoiceLength - len(duration); len(name) > maxNameLength {
+		name = append(name[:maxNameLength-1], '…')
+	}
+	return string(name) + duration
+}
+
+func onAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommandAutocomplete || i.Member == nil {
+		return
+	}
+	// Find the focused option
+	var query string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Focused {
+			query = option.StringValue()
+		}
+	}
+	choices := autocompleteState.Suggest(i.Member.User.ID, query)
+	if choices == nil {
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Println("cannot respond to autocomplete:", err)
+	}
+}
@@ -3,42 +3,102 @@ package bot
 import (
 	"Deemix-Discord-Bot/config"
 	"Deemix-Discord-Bot/deezer"
+	"Deemix-Discord-Bot/spotify"
 	"github.com/bwmarrin/discordgo"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// downloadRetryBackoff is the delay before retrying a failed download for the first time
+// It's doubled for each retry
+const downloadRetryBackoff = 2 * time.Second
+
 // RunBot runs the discord bot with config.Config configurations
 func RunBot() {
+	deezerClient.UserAgent = "Deemix-Discord-Bot/" + config.Version
+	deezerClient.CacheSize = config.Config.SearchCacheSize
+	deezerClient.CacheTTL = time.Duration(config.Config.SearchCacheTTLMinutes) * time.Minute
+	// Enable spotify links if the credentials are given
+	if config.Config.SpotifyClientID != "" && config.Config.SpotifyClientSecret != "" {
+		deezerClient.Spotify = spotify.NewClient(config.Config.SpotifyClientID, config.Config.SpotifyClientSecret)
+	}
+	// Create the downloader
+	setupDeemixConfig()
+	defer deemixConfig.Delete()
+	var err error
+	downloader, err = deezer.NewDownloader(config.Config.Downloader, deezer.DownloaderOptions{
+		LocalDirectory: config.Config.LocalMusicDirectory,
+		Timeout:        time.Duration(config.Config.DownloadTimeoutSeconds) * time.Second,
+		DeemixConfig:   deemixConfig,
+	})
+	if err != nil {
+		log.Fatalln("Cannot create the downloader:", err)
+	}
+	// Limit the concurrent downloads of all guilds. Cached tracks don't need a worker
+	downloader = deezer.NewDownloadScheduler(downloader, config.Config.DownloadWorkers)
+	// Retry the failed downloads without keeping a worker while waiting
+	downloader = deezer.NewRetryDownloader(downloader, config.Config.DownloadRetries, downloadRetryBackoff)
+	if config.Config.CacheDirectory != "" {
+		downloader, err = deezer.NewCachedDownloader(downloader, config.Config.CacheDirectory, config.Config.CacheSizeMB*1024*1024)
+		if err != nil {
+			log.Fatalln("Cannot create the track cache:", err)
+		}
+	}
+	// Check the qualities
+	if _, err = deezer.ParseQuality(config.Config.Quality); err != nil {
+		log.Fatalln("Cannot parse the quality:", err)
+	}
+	for guildID, quality := range config.Config.GuildQualities {
+		if _, err = deezer.ParseQuality(quality); err != nil {
+			log.Fatalln("Cannot parse the quality of guild", guildID, ":", err)
+		}
+	}
+	// Prepare the commands
+	buildCommandLookup()
+	checkCustomAliases()
+	helpMessage = generateHelpMessage(config.Version, commandPrefix())
 	// Start the server cleanup
 	go serverList.cleanupIdleServers()
+	go searchList.cleanupExpiredSearches()
+	go autocompleteState.cleanupFinishedRequests()
 	// Start the discord bot
 	dg, err := discordgo.New("Bot " + config.Config.Token)
 	if err != nil {
 		log.Fatalln("Error creating Discord session: ", err)
 	}
 	dg.AddHandler(onReady)
-	dg.AddHandler(onMessage)
 	dg.AddHandler(onVoiceUpdate)
-	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsGuildVoiceStates
+	dg.AddHandler(onReactionAdd)
+	dg.AddHandler(onInteraction)
+	dg.AddHandler(onAutocomplete)
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildVoiceStates | discordgo.IntentsGuildMessageReactions
+	// Message content is a privileged intent. Discord refuses the connection if it's not enabled for the bot
+	if config.Config.PrefixCommands {
+		dg.AddHandler(onMessage)
+		dg.Identify.Intents |= discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
+	}
 	err = dg.Open()
 	if err != nil {
 		log.Fatalln("Error opening Discord session: ", err)
 	}
+	loadOwner(dg)
 	log.Println("Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 	<-sc
 	_ = dg.Close()
+	hits, misses := deezerClient.CacheStats()
+	log.Printf("Deezer search cache had %d hits and %d misses\n", hits, misses)
 	log.Println("Clean shutdown the bot")
 }
 
 func onReady(s *discordgo.Session, _ *discordgo.Ready) {
-	_ = s.UpdateGameStatus(0, config.Config.Prefix+"help")
+	_ = s.UpdateGameStatus(0, commandPrefix()+"help")
+	registerApplicationCommands(s)
 }
 
 func onVoiceUpdate(s *discordgo.Session, m *discordgo.VoiceStateUpdate) {
@@ -72,11 +132,18 @@ func onMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 	// Check the command prefix
-	if !strings.HasPrefix(m.Content, config.Config.Prefix) {
+	if len(m.Content) < len(config.Config.Prefix) || !strings.EqualFold(m.Content[:len(config.Config.Prefix)], config.Config.Prefix) {
+		return
+	}
+	command, args, err := ParseCommand(m.GuildID, m.Content[len(config.Config.Prefix):])
+	if err == InvalidCommandError {
 		return
 	}
-	var command Command
-	if command.Parse(m.Content[len(config.Config.Prefix):]) != nil {
+	if command.Secret {
+		deleteSecretCommand(s, m)
+	}
+	if err != nil {
+		_, _ = s.ChannelMessageSendReply(m.ChannelID, "Invalid arguments: "+err.Error()+"\nUsage: `"+config.Config.Prefix+command.Usage()+"`", m.Reference())
 		return
 	}
 	// Find the channel that the message came from.
@@ -91,77 +158,59 @@ func onMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 		log.Println("cannot get the guild:", err)
 		return
 	}
-	// Check the command
-	switch command {
-	case CommandHelp:
-		_, _ = s.ChannelMessageSendReply(c.ID, config.HelpMessage, m.Reference())
-	case CommandRepo:
-		_, _ = s.ChannelMessageSendReply(c.ID, config.Repo, m.Reference())
-	case CommandStop:
-		serverList.Stop(g.ID)
-	case CommandSkip:
-		serverList.Skip(g.ID)
-	case CommandQueueView:
-		_, _ = s.ChannelMessageSendReply(c.ID, serverList.GetQueueText(g.ID), m.Reference())
-	case CommandPause:
-		serverList.Pause(g.ID, true)
-	case CommandResume:
-		serverList.Pause(g.ID, false)
-	case CommandQueueRemove:
-		index, err := strconv.Atoi(strings.Trim(m.Content[len(config.Config.Prefix)+len(removeFromQueueCommand):], " "))
-		if err != nil {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Please pass the index of the music as well.\nFor example `"+config.Config.Prefix+"remove 2`", m.Reference())
-			return
-		}
-		ok := serverList.RemoveQueuedTrack(g.ID, index)
-		if ok {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Removed", m.Reference())
-		} else {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Invalid index", m.Reference())
-		}
-	case CommandQueuePop:
-		ok := serverList.Pop(g.ID)
-		if ok {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Popped!", m.Reference())
-		} else {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Nothing to remove", m.Reference())
-		}
-	case CommandPlay:
-		// Find the user's voice channel
-		for _, vs := range g.VoiceStates {
-			if vs.UserID == m.Author.ID {
-				// Play it in another goroutine
-				go playMusic(s, g.ID, vs.ChannelID, c.ID, strings.Trim(m.Content[len(config.Config.Prefix)+len(playCommand):], " "))
-				return
-			}
-		}
-		_, _ = s.ChannelMessageSendReply(c.ID, "Join a voice channel!", m.Reference())
-	case CommandPlayingTrack:
-		track, playing := serverList.GetPlayingTrack(g.ID)
-		if !playing {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Nothing is playing!", m.Reference())
-		} else {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Currently playing: "+track.String(), m.Reference())
-		}
-	case CommandSearch:
-		tracks, err := deezer.SearchTrack(strings.Trim(m.Content[len(config.Config.Prefix)+len(searchCommand):], " "))
-		if err != nil {
-			_, _ = s.ChannelMessageSendReply(c.ID, "Cannot search the deezer", m.Reference())
-			log.Println("Cannot search the deezer", err)
-			return
-		}
-		if len(tracks) == 0 {
-			_, _ = s.ChannelMessageSendReply(c.ID, "No track found! Deezer search sucks a bit!", m.Reference())
-			return
-		}
-		// Create the search message
-		var sb strings.Builder
-		sb.Grow(4096)
-		//sb.WriteString("```")
-		for _, track := range tracks {
-			track.Append(&sb)
+	permissions, err := s.State.UserChannelPermissions(m.Author.ID, c.ID)
+	if err != nil {
+		log.Println("cannot get the permissions:", err)
+		return
+	}
+	// Run the command
+	executeCommand(commandContext{
+		session:     s,
+		guild:       g,
+		channelID:   c.ID,
+		userID:      m.Author.ID,
+		messageID:   m.ID,
+		permissions: permissions,
+		reply: func(content string) (*discordgo.Message, error) {
+			return s.ChannelMessageSendReply(c.ID, content, m.Reference())
+		},
+	}, command, args)
+}
+
+func onReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	// Ignore all reactions created by the bot itself
+	if r.UserID == s.State.User.ID {
+		return
+	}
+	// Check if the reaction is on a search result
+	index := emojiIndex(r.Emoji.Name)
+	if index == -1 {
+		return
+	}
+	result, ok := searchList.PickByMessage(r.MessageID, r.UserID, index)
+	if !ok {
+		return
+	}
+	// Find the guild of the message
+	g, err := s.State.Guild(r.GuildID)
+	if err != nil {
+		log.Println("cannot get the guild:", err)
+		return
+	}
+	voiceChannelID, ok := userVoiceChannel(g, r.UserID)
+	if !ok {
+		_, _ = s.ChannelMessageSend(r.ChannelID, "Join a voice channel!")
+		return
+	}
+	go playMusic(s, g.ID, voiceChannelID, r.ChannelID, result.Link, defaultArtistTopTracks)
+}
+
+// userVoiceChannel finds the voice channel which a user has joined in a guild
+func userVoiceChannel(g *discordgo.Guild, userID string) (channelID string, ok bool) {
+	for _, vs := range g.VoiceStates {
+		if vs.UserID == userID {
+			return vs.ChannelID, true
 		}
-		//sb.WriteString("```")
-		_, _ = s.ChannelMessageSendReply(c.ID, sb.String(), m.Reference())
 	}
+	return "", false
 }
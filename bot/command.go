@@ -1,70 +1,302 @@
 package bot
 
 import (
+	"Deemix-Discord-Bot/config"
 	"errors"
+	"log"
+	"strconv"
 	"strings"
 )
 
 var InvalidCommandError = errors.New("invalid command")
 
-const playCommand = "play"
-const removeFromQueueCommand = "remove"
-const searchCommand = "search"
+// UnterminatedQuoteError is returned when a quote in the command is not closed
+var UnterminatedQuoteError = errors.New("unterminated quote")
 
-// Command is a command which is given to the bot
-type Command byte
+// argType is the type of an argument of a command
+type argType byte
 
 const (
-	CommandHelp Command = iota
-	CommandPlay
-	CommandStop
-	CommandRepo
-	CommandPlayingTrack
-	CommandSkip
-	CommandQueueView
-	CommandQueueRemove
-	CommandQueuePop
-	CommandPause
-	CommandResume
-	CommandSearch
+	// argString is a single word or a quoted text
+	argString argType = iota
+	// argInteger is a single integer
+	argInteger
+	// argText is the rest of the command
+	argText
 )
 
-// Parse parses the command given to bot as Command
+// commandArg is an argument which a command accepts
+type commandArg struct {
+	// The name of argument
+	Name string
+	// The description of argument
+	Description string
+	// The type of argument
+	Type argType
+	// Is this argument required or not
+	Required bool
+	// If true, the integer argument must be positive
+	Positive bool
+	// If true, discord asks the bot for suggestions while the user is typing the argument
+	Autocomplete bool
+}
+
+// usage returns the argument as it's shown in help
+func (a commandArg) usage() string {
+	if a.Required {
+		return "<" + a.Name + ">"
+	}
+	return "[" + a.Name + "]"
+}
+
+// Command is a command which is given to the bot
+type Command struct {
+	// The name of command
+	Name string
+	// Other names which this command can be called with
+	Aliases []string
+	// The arguments of the command in order
+	// An argText argument consumes the rest of a prefix command. The arguments after it can
+	// only be given in application commands.
+	Args []commandArg
+	// The discord permissions which the user needs to run this command
+	Permissions int64
+	// If true, only the owner of bot can run this command
+	// The responses of application commands are only shown to the user who ran it.
+	OwnerOnly bool
+	// If true, the message of prefix command is deleted because its arguments must not stay in chat
+	Secret bool
+	// The description of command which is shown in help
+	Help string
+	// The message which is sent to the application commands if Handler does not reply
+	Ack string
+	// Handler runs the command
+	Handler func(ctx commandContext, args commandArgs)
+}
+
+// Usage returns the usage of command like "remove <index>"
+func (c *Command) Usage() string {
+	var sb strings.Builder
+	sb.WriteString(c.Name)
+	for _, arg := range c.Args {
+		sb.WriteByte(' ')
+		sb.WriteString(arg.usage())
+	}
+	return sb.String()
+}
+
+// commandArgs is the parsed arguments of a command mapped from their names
+type commandArgs map[string]string
+
+// String gets an argument as string
+// Empty string is returned if the argument is not given
+func (a commandArgs) String(name string) string {
+	return a[name]
+}
+
+// Int gets an argument as integer
+func (a commandArgs) Int(name string) (int, bool) {
+	value, exists := a[name]
+	if !exists {
+		return 0, false
+	}
+	result, err := strconv.Atoi(value)
+	return result, err == nil
+}
+
+// token is a word in a command
+type token struct {
+	// The value of word without the quotes
+	value string
+	// True if the word was in quotes
+	quoted bool
+}
+
+// nextToken reads the next word of input from the given position
+// Words are separated with whitespace. A word which starts with double or single quote
+// continues until the closing quote and backslash escapes the next character in it.
+// It returns the word and the position after it. ok is false if there is no word left.
+func nextToken(input string, pos int) (result token, next int, ok bool, err error) {
+	pos = skipSpaces(input, pos)
+	if pos == len(input) {
+		return token{}, pos, false, nil
+	}
+	var sb strings.Builder
+	// Quoted word
+	if quote := input[pos]; quote == '"' || quote == '\'' {
+		for i := pos + 1; i < len(input); i++ {
+			switch input[i] {
+			case '\\':
+				if i+1 < len(input) {
+					i++
+					sb.WriteByte(input[i])
+				}
+			case quote:
+				return token{value: sb.String(), quoted: true}, i + 1, true, nil
+			default:
+				sb.WriteByte(input[i])
+			}
+		}
+		return token{}, pos, false, UnterminatedQuoteError
+	}
+	// Simple word
+	end := pos
+	for end < len(input) && !isSpace(input[end]) {
+		end++
+	}
+	return token{value: input[pos:end]}, end, true, nil
+}
+
+// skipSpaces returns the position of first non whitespace character from pos
+func skipSpaces(input string, pos int) int {
+	for pos < len(input) && isSpace(input[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// isSpace checks if a character separates words
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// ParseCommand parses the command given to bot in a guild
 // Please note that input must not contain the prefix
-func (c *Command) Parse(input string) error {
-	if strings.HasPrefix(input, playCommand+" ") {
-		*c = CommandPlay
-		return nil
-	}
-	if strings.HasPrefix(input, removeFromQueueCommand+" ") {
-		*c = CommandQueueRemove
-		return nil
-	}
-	if strings.HasPrefix(input, searchCommand+" ") {
-		*c = CommandSearch
-		return nil
-	}
-	switch input {
-	case "stop":
-		*c = CommandStop
-	case "help":
-		*c = CommandHelp
-	case "repo":
-		*c = CommandRepo
-	case "playing":
-		*c = CommandPlayingTrack
-	case "skip":
-		*c = CommandSkip
-	case "queue":
-		*c = CommandQueueView
-	case "pop":
-		*c = CommandQueuePop
-	case "pause":
-		*c = CommandPause
-	case "resume":
-		*c = CommandResume
-	default:
-		return InvalidCommandError
+func ParseCommand(guildID, input string) (*Command, commandArgs, error) {
+	name, pos, ok, err := nextToken(input, 0)
+	if err != nil || !ok || name.quoted {
+		return nil, nil, InvalidCommandError
+	}
+	command := findCommand(guildID, name.value)
+	if command == nil {
+		return nil, nil, InvalidCommandError
+	}
+	args, err := command.bindArgs(input, pos)
+	return command, args, err
+}
+
+// bindArgs maps the words after the command name to the arguments of a command
+// pos is the position of the end of command name in input
+func (c *Command) bindArgs(input string, pos int) (commandArgs, error) {
+	args := make(commandArgs, len(c.Args))
+	for _, arg := range c.Args {
+		if arg.Type == argText {
+			// The raw text is used to keep the quotes unless the whole text is a single quoted word
+			text := strings.TrimSpace(input[pos:])
+			if word, next, ok, err := nextToken(input, pos); err == nil && ok && word.quoted && skipSpaces(input, next) == len(input) {
+				text = word.value
+			}
+			args[arg.Name] = text
+			pos = len(input)
+			break
+		}
+		word, next, ok, err := nextToken(input, pos)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		args[arg.Name] = word.value
+		pos = next
+	}
+	if skipSpaces(input, pos) != len(input) {
+		return nil, errors.New("too many arguments")
+	}
+	return args, c.validateArgs(args)
+}
+
+// validateArgs checks the type of arguments and makes sure that the required arguments exist
+func (c *Command) validateArgs(args commandArgs) error {
+	for _, arg := range c.Args {
+		value, exists := args[arg.Name]
+		if !exists || value == "" {
+			if arg.Required {
+				return errors.New("missing " + arg.Name)
+			}
+			delete(args, arg.Name)
+			continue
+		}
+		if arg.Type == argInteger {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return errors.New(arg.Name + " must be a number")
+			}
+			if arg.Positive && n <= 0 {
+				return errors.New(arg.Name + " must be positive")
+			}
+		}
+	}
+	return nil
+}
+
+// commandLookup maps the names and aliases of commands to them
+var commandLookup map[string]*Command
+
+// buildCommandLookup fills commandLookup from the commands list
+func buildCommandLookup() {
+	commandLookup = make(map[string]*Command, len(commands))
+	for _, command := range commands {
+		commandLookup[command.Name] = command
+		for _, alias := range command.Aliases {
+			commandLookup[alias] = command
+		}
+	}
+}
+
+// findCommand finds a command by its name or aliases
+// If the name is not a built-in command, the custom aliases of the guild are checked
+// The name is not case-sensitive
+func findCommand(guildID, name string) *Command {
+	name = strings.ToLower(name)
+	if command, exists := commandLookup[name]; exists {
+		return command
+	}
+	if target, exists := config.Config.Aliases[guildID][name]; exists {
+		return commandLookup[strings.ToLower(target)]
 	}
 	return nil
 }
+
+// checkCustomAliases logs the custom aliases which don't point to any command
+func checkCustomAliases() {
+	for guildID, aliases := range config.Config.Aliases {
+		for alias, target := range aliases {
+			if _, exists := commandLookup[strings.ToLower(target)]; !exists {
+				log.Printf("Alias %s of guild %s points to unknown command %s\n", alias, guildID, target)
+			}
+		}
+	}
+}
+
+// commandPrefix returns the prefix which the users should use to run the commands
+// It's the slash of application commands if the prefix commands are disabled
+func commandPrefix() string {
+	if config.Config.PrefixCommands {
+		return config.Config.Prefix
+	}
+	return "/"
+}
+
+// generateHelpMessage creates the help message from the commands list
+func generateHelpMessage(version, prefix string) string {
+	var sb strings.Builder
+	sb.WriteString("Welcome to my private music bot v" + version + ". Here are the list of commands which you can use:\n")
+	for _, command := range commands {
+		sb.WriteString(prefix)
+		sb.WriteString(command.Usage())
+		sb.WriteString(" : ")
+		sb.WriteString(command.Help)
+		// Aliases only work in prefix commands
+		if len(command.Aliases) != 0 && prefix != "/" {
+			sb.WriteString(" (aliases: ")
+			sb.WriteString(strings.Join(command.Aliases, ", "))
+			sb.WriteByte(')')
+		}
+		sb.WriteByte('\n')
+	}
+	if prefix != "/" {
+		sb.WriteString("All of the commands are also available as slash commands like /play")
+	}
+	return sb.String()
+}
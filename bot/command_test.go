@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"reflect"
+	"testing"
+)
+
+func TestNextToken(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []token
+		err    error
+	}{
+		{"", nil, nil},
+		{"   ", nil, nil},
+		{"play", []token{{value: "play"}}, nil},
+		{"  play \t song\n", []token{{value: "play"}, {value: "song"}}, nil},
+		{`"daft punk" one`, []token{{value: "daft punk", quoted: true}, {value: "one"}}, nil},
+		{`'daft punk'`, []token{{value: "daft punk", quoted: true}}, nil},
+		{`"say \"hi\""`, []token{{value: `say "hi"`, quoted: true}}, nil},
+		{`'it\'s'`, []token{{value: "it's", quoted: true}}, nil},
+		{`"a\\b"`, []token{{value: `a\b`, quoted: true}}, nil},
+		{`"it's"`, []token{{value: "it's", quoted: true}}, nil},
+		{`""`, []token{{value: "", quoted: true}}, nil},
+		// Quotes in the middle of a word are not special
+		{`don't stop`, []token{{value: "don't"}, {value: "stop"}}, nil},
+		{`"unterminated`, nil, UnterminatedQuoteError},
+		{`ok "unterminated \"`, []token{{value: "ok"}}, UnterminatedQuoteError},
+	}
+	for _, test := range tests {
+		var tokens []token
+		var err error
+		for pos := 0; ; {
+			var word token
+			var ok bool
+			word, pos, ok, err = nextToken(test.input, pos)
+			if err != nil || !ok {
+				break
+			}
+			tokens = append(tokens, word)
+		}
+		if err != test.err {
+			t.Errorf("%q: expected error %v, got %v", test.input, test.err, err)
+		}
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("%q: expected tokens %+v, got %+v", test.input, test.tokens, tokens)
+		}
+	}
+}
+
+func TestBindArgs(t *testing.T) {
+	remove := &Command{
+		Name: "remove",
+		Args: []commandArg{
+			{Name: "index", Type: argInteger, Required: true, Positive: true},
+		},
+	}
+	move := &Command{
+		Name: "move",
+		Args: []commandArg{
+			{Name: "name", Type: argString, Required: true},
+			{Name: "to", Type: argInteger},
+		},
+	}
+	play := &Command{
+		Name: "play",
+		Args: []commandArg{
+			{Name: "query", Type: argText, Required: true},
+			{Name: "count", Type: argInteger, Positive: true},
+		},
+	}
+	tests := []struct {
+		command *Command
+		input   string
+		args    commandArgs
+		valid   bool
+	}{
+		{remove, "2", commandArgs{"index": "2"}, true},
+		{remove, " 2 ", commandArgs{"index": "2"}, true},
+		{remove, "", nil, false},
+		{remove, "two", nil, false},
+		{remove, "0", nil, false},
+		{remove, "-1", nil, false},
+		{remove, "2 3", nil, false},
+		{move, "song", commandArgs{"name": "song"}, true},
+		{move, `"my song" 4`, commandArgs{"name": "my song", "to": "4"}, true},
+		{move, `my song 4`, nil, false},
+		{move, `"my song`, nil, false},
+		{move, `song -4`, commandArgs{"name": "song", "to": "-4"}, true},
+		// The text is kept raw unless it's a single quoted word
+		{play, "daft punk", commandArgs{"query": "daft punk"}, true},
+		{play, "  daft   punk  ", commandArgs{"query": "daft   punk"}, true},
+		{play, `"daft punk"`, commandArgs{"query": "daft punk"}, true},
+		{play, `artist:"daft punk" track:"one"`, commandArgs{"query": `artist:"daft punk" track:"one"`}, true},
+		{play, `"daft" "punk"`, commandArgs{"query": `"daft" "punk"`}, true},
+		{play, `don't "stop`, commandArgs{"query": `don't "stop`}, true},
+		{play, "https://www.deezer.com/artist/27 5", commandArgs{"query": "https://www.deezer.com/artist/27 5"}, true},
+		{play, "", nil, false},
+		{play, `""`, nil, false},
+	}
+	for _, test := range tests {
+		args, err := test.command.bindArgs(test.input, 0)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s %q: expected an error, got %v", test.command.Name, test.input, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: unexpected error %s", test.command.Name, test.input, err)
+		} else if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s %q: expected %v, got %v", test.command.Name, test.input, test.args, args)
+		}
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	buildCommandLookup()
+	tests := []struct {
+		input   string
+		command string
+		args    commandArgs
+		err     error
+	}{
+		{"play daft punk", "play", commandArgs{"query": "daft punk"}, nil},
+		{"P daft punk", "play", commandArgs{"query": "daft punk"}, nil},
+		{"remove 3", "remove", commandArgs{"index": "3"}, nil},
+		{"skip", "skip", commandArgs{}, nil},
+		{"unknown", "", nil, InvalidCommandError},
+		{`"play" song`, "", nil, InvalidCommandError},
+		{"", "", nil, InvalidCommandError},
+	}
+	for _, test := range tests {
+		command, args, err := ParseCommand("", test.input)
+		if err != test.err {
+			t.Errorf("%q: expected error %v, got %v", test.input, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if command.Name != test.command || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: expected %s %v, got %s %v", test.input, test.command, test.args, command.Name, args)
+		}
+	}
+	// Too many arguments are reported with the command to show its usage
+	command, _, err := ParseCommand("", "skip now")
+	if err == nil || command == nil || command.Name != "skip" {
+		t.Errorf("expected too many arguments error for skip, got %v", err)
+	}
+}
+
+func TestExecuteCommandPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     Command
+		userID      string
+		permissions int64
+		allowed     bool
+	}{
+		{"no requirement", Command{}, "user", 0, true},
+		{"missing permission", Command{Permissions: discordgo.PermissionVoiceMoveMembers}, "user", discordgo.PermissionSendMessages, false},
+		{"has permission", Command{Permissions: discordgo.PermissionVoiceMoveMembers}, "user", discordgo.PermissionVoiceMoveMembers | discordgo.PermissionSendMessages, true},
+		{"not owner", Command{OwnerOnly: true}, "user", discordgo.PermissionAll, false},
+		{"owner", Command{OwnerOnly: true}, "owner", 0, true},
+	}
+	oldOwnerID := ownerID
+	ownerID = "owner"
+	defer func() {
+		ownerID = oldOwnerID
+	}()
+	for _, test := range tests {
+		ran, replied := false, false
+		command := test.command
+		command.Handler = func(commandContext, commandArgs) {
+			ran = true
+		}
+		executeCommand(commandContext{
+			userID:      test.userID,
+			permissions: test.permissions,
+			reply: func(string) (*discordgo.Message, error) {
+				replied = true
+				return nil, nil
+			},
+		}, &command, nil)
+		if ran != test.allowed || replied == test.allowed {
+			t.Errorf("%s: expected allowed %v, got ran %v and replied %v", test.name, test.allowed, ran, replied)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/config"
+	"github.com/bwmarrin/discordgo"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// helpMessage is the message which is shown in help command
+// It's generated from commands when the bot starts
+var helpMessage string
+
+// commands is the list of all commands which the bot understands
+// The help message and the application commands are generated from this list in this order
+var commands = []*Command{
+	{
+		Name:    "help",
+		Aliases: []string{"h"},
+		Help:    "Show this message again",
+		Handler: func(ctx commandContext, _ commandArgs) {
+			_, _ = ctx.reply(helpMessage)
+		},
+	},
+	{
+		Name:    "play",
+		Aliases: []string{"p"},
+		Args: []commandArg{
+			{
+				Name:         "query",
+				Description:  "Link or keyword of the music",
+				Type:         argText,
+				Required:     true,
+				Autocomplete: true,
+			},
+			{
+				Name:        "count",
+				Description: "Number of top tracks to play if the link is an artist",
+				Type:        argInteger,
+				Positive:    true,
+			},
+		},
+		Help:    "Play a song, album, playlist or artist from deezer/spotify, or search and play a song",
+		Ack:     "Loading the music...",
+		Handler: commandPlay,
+	},
+	{
+		Name:    "skip",
+		Aliases: []string{"s", "next"},
+		Help:    "Skip the current song",
+		Ack:     "Skipped",
+		Handler: commandSkip,
+	},
+	{
+		Name:    "queue",
+		Aliases: []string{"q"},
+		Help:    "Show the queue",
+		Handler: commandQueue,
+	},
+	{
+		Name:    "remove",
+		Aliases: []string{"rm"},
+		Args: []commandArg{
+			{
+				Name:        "index",
+				Description: "Index of the track in queue",
+				Type:        argInteger,
+				Required:    true,
+				Positive:    true,
+			},
+		},
+		Help:    "Removes the nth track from queue",
+		Handler: commandRemove,
+	},
+	{
+		Name:    "pop",
+		Help:    "Removes the last track from queue",
+		Handler: commandPop,
+	},
+	{
+		Name:    "pause",
+		Help:    "Pause the playing music",
+		Ack:     "Paused",
+		Handler: commandPause,
+	},
+	{
+		Name:    "resume",
+		Aliases: []string{"unpause"},
+		Help:    "Resume the paused music",
+		Ack:     "Resumed",
+		Handler: commandResume,
+	},
+	{
+		Name:    "playing",
+		Aliases: []string{"np", "nowplaying"},
+		Help:    "Show playing song name",
+		Handler: commandPlaying,
+	},
+	{
+		Name:    "search",
+		Aliases: []string{"find"},
+		Args: []commandArg{
+			{
+				Name:        "keyword",
+				Description: "Keyword to search. Start it with album:, artist: or playlist: to search them",
+				Type:        argText,
+				Required:    true,
+			},
+		},
+		Help:    "Search a track, album, artist or playlist in deezer",
+		Handler: commandSearch,
+	},
+	{
+		Name:    "pick",
+		Aliases: []string{"choose"},
+		Args: []commandArg{
+			{
+				Name:        "number",
+				Description: "Number of the search result",
+				Type:        argInteger,
+				Required:    true,
+				Positive:    true,
+			},
+		},
+		Help:    "Play the nth result of your last search",
+		Ack:     "Loading the music...",
+		Handler: commandPick,
+	},
+	{
+		Name:    "stop",
+		Aliases: []string{"leave"},
+		Help:    "Stops the playing music",
+		Ack:     "Stopped",
+		// Stopping clears the queue of everyone, so it needs the permission to disconnect the members
+		Permissions: discordgo.PermissionVoiceMoveMembers,
+		Handler:     commandStop,
+	},
+	{
+		Name: "arl",
+		Args: []commandArg{
+			{
+				Name:        "arl",
+				Description: "The new ARL cookie of deezer account",
+				Type:        argString,
+				Required:    true,
+			},
+		},
+		Help:      "Replace the deezer ARL of bot. Only the owner of bot can use it",
+		OwnerOnly: true,
+		Secret:    true,
+		Handler:   commandArl,
+	},
+	{
+		Name: "repo",
+		Help: "Show the source code",
+		Handler: func(ctx commandContext, _ commandArgs) {
+			_, _ = ctx.reply(config.Repo)
+		},
+	},
+}
+
+func commandPlay(ctx commandContext, args commandArgs) {
+	// Find the user's voice channel
+	voiceChannelID, ok := userVoiceChannel(ctx.guild, ctx.userID)
+	if !ok {
+		_, _ = ctx.reply("Join a voice channel!")
+		return
+	}
+	// Application commands send the count separately. Prefix commands have it after the link
+	query, count := args.String("query"), defaultArtistTopTracks
+	if n, ok := args.Int("count"); ok {
+		count = n
+	} else {
+		query, count = splitTrackCount(query)
+	}
+	// Play it in another goroutine
+	go playMusic(ctx.session, ctx.guild.ID, voiceChannelID, ctx.channelID, query, count)
+}
+
+func commandSkip(ctx commandContext, _ commandArgs) {
+	serverList.Skip(ctx.guild.ID)
+}
+
+func commandQueue(ctx commandContext, _ commandArgs) {
+	_, _ = ctx.reply(serverList.GetQueueText(ctx.guild.ID))
+}
+
+func commandRemove(ctx commandContext, args commandArgs) {
+	index, _ := args.Int("index")
+	if serverList.RemoveQueuedTrack(ctx.guild.ID, index) {
+		_, _ = ctx.reply("Removed")
+	} else {
+		_, _ = ctx.reply("Invalid index")
+	}
+}
+
+func commandPop(ctx commandContext, _ commandArgs) {
+	if serverList.Pop(ctx.guild.ID) {
+		_, _ = ctx.reply("Popped!")
+	} else {
+		_, _ = ctx.reply("Nothing to remove")
+	}
+}
+
+func commandPause(ctx commandContext, _ commandArgs) {
+	serverList.Pause(ctx.guild.ID, true)
+}
+
+func commandResume(ctx commandContext, _ commandArgs) {
+	serverList.Pause(ctx.guild.ID, false)
+}
+
+func commandPlaying(ctx commandContext, _ commandArgs) {
+	track, playing := serverList.GetPlayingTrack(ctx.guild.ID)
+	if !playing {
+		_, _ = ctx.reply("Nothing is playing!")
+	} else {
+		message := "Currently playing: " + track.Summary()
+		if track.Album != "" {
+			message += "\nAlbum: " + track.Album
+		}
+		_, _ = ctx.reply(message)
+	}
+}
+
+func commandSearch(ctx commandContext, args commandArgs) {
+	results, err := deezerClient.Search(args.String("keyword"))
+	if err != nil {
+		_, _ = ctx.reply("Cannot search the deezer")
+		log.Println("Cannot search the deezer", err)
+		return
+	}
+	if len(results) == 0 {
+		_, _ = ctx.reply("Nothing found! Deezer search sucks a bit!")
+		return
+	}
+	// Create the search message
+	var sb strings.Builder
+	sb.Grow(4096)
+	//sb.WriteString("```")
+	for i, result := range results {
+		sb.WriteString("\n**")
+		sb.WriteString(strconv.Itoa(i + 1))
+		sb.WriteString(".**")
+		result.Append(&sb)
+	}
+	//sb.WriteString("```")
+	sb.WriteString("Use `" + commandPrefix() + "pick <number>` or react with the number to play a result")
+	message, err := ctx.reply(sb.String())
+	if err != nil {
+		return
+	}
+	// Let the user pick one of the results
+	searchList.Add(ctx.channelID, ctx.userID, message.ID, results)
+	for i := range results {
+		if i >= len(numberEmojis) {
+			break
+		}
+		_ = ctx.session.MessageReactionAdd(ctx.channelID, message.ID, numberEmojis[i])
+	}
+}
+
+func commandPick(ctx commandContext, args commandArgs) {
+	index, _ := args.Int("number")
+	result, ok := searchList.Pick(ctx.channelID, ctx.userID, index)
+	if !ok {
+		_, _ = ctx.reply("Invalid number or your search has expired")
+		return
+	}
+	voiceChannelID, ok := userVoiceChannel(ctx.guild, ctx.userID)
+	if !ok {
+		_, _ = ctx.reply("Join a voice channel!")
+		return
+	}
+	go playMusic(ctx.session, ctx.guild.ID, voiceChannelID, ctx.channelID, result.Link, defaultArtistTopTracks)
+}
+
+func commandStop(ctx commandContext, _ commandArgs) {
+	serverList.Stop(ctx.guild.ID)
+}
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/jonas747/dca"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// encodedAudio is a source of opus frames of an audio
+type encodedAudio interface {
+	dca.OpusReader
+	// Cleanup releases the resources of the source
+	Cleanup()
+}
+
+// encodeAudio creates the opus frames of an audio
+// If the audio has the frames encoded with the same options in its sidecar, they are used directly.
+// Otherwise, the audio is encoded with ffmpeg and the frames are stored in its sidecar if possible.
+// If the audio is still being downloaded, it's piped to ffmpeg while it's written.
+func encodeAudio(audio *deezer.Audio, options *dca.EncodeOptions) (encodedAudio, error) {
+	if audio.Downloading() {
+		return encodeDownloadingAudio(audio, options)
+	}
+	sidecarPath, canStore := audio.SidecarPath("opus-" + encodeOptionsKey(options) + ".dca")
+	// Check the stored frames
+	if canStore {
+		if file, err := os.Open(sidecarPath); err == nil {
+			return &storedFrames{
+				file:          file,
+				reader:        bufio.NewReader(file),
+				frameDuration: time.Duration(options.FrameDuration) * time.Millisecond,
+			}, nil
+		}
+	}
+	// Encode the file
+	session, err := dca.EncodeFile(audio.Path, options)
+	if err != nil {
+		return nil, err
+	}
+	if !canStore {
+		return session, nil
+	}
+	// Store the frames while streaming them
+	file, err := os.CreateTemp(filepath.Dir(sidecarPath), deezer.PartialFilePattern)
+	if err != nil {
+		log.Println("cannot store the encoded frames:", err)
+		return session, nil
+	}
+	return &storingFrames{
+		encodedAudio: session,
+		audio:        audio,
+		file:         file,
+		writer:       bufio.NewWriter(file),
+		path:         sidecarPath,
+	}, nil
+}
+
+// encodeDownloadingAudio encodes an audio which is still being downloaded
+func encodeDownloadingAudio(audio *deezer.Audio, options *dca.EncodeOptions) (encodedAudio, error) {
+	reader, err := audio.Open()
+	if err != nil {
+		return nil, err
+	}
+	session, err := dca.EncodeMem(reader, options)
+	if err != nil {
+		_ = reader.Close()
+		return nil, err
+	}
+	return &streamingFrames{EncodeSession: session, reader: reader}, nil
+}
+
+// encodeOptionsKey creates a key from encoding options
+// Frames which are encoded with different options have different keys
+func encodeOptionsKey(options *dca.EncodeOptions) string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%+v", *options)))
+	return hex.EncodeToString(hash[:8])
+}
+
+// storedFrames reads the opus frames which are stored in a file in DCA format without metadata
+type storedFrames struct {
+	file          *os.File
+	reader        *bufio.Reader
+	frameDuration time.Duration
+}
+
+// OpusFrame reads the next frame
+func (s *storedFrames) OpusFrame() ([]byte, error) {
+	return dca.DecodeFrame(s.reader)
+}
+
+// FrameDuration returns the duration of each frame
+func (s *storedFrames) FrameDuration() time.Duration {
+	return s.frameDuration
+}
+
+// Cleanup closes the file
+func (s *storedFrames) Cleanup() {
+	_ = s.file.Close()
+}
+
+// finishEncoding releases an encoded audio
+// complete must be true only if the stream of audio ended because all of its frames were played.
+// The stored frames are kept only in that case, because the encoder is killed when the track is skipped.
+func finishEncoding(frames encodedAudio, complete bool) {
+	if storing, ok := frames.(*storingFrames); ok && complete {
+		storing.markComplete()
+	}
+	frames.Cleanup()
+}
+
+// storingFrames encodes an audio and stores the frames in a file while they are read
+// The file is kept only if all frames are read and the stream is marked as complete.
+// OpusFrame is called by the stream goroutine while Cleanup is called by the player, so the fields are locked.
+type storingFrames struct {
+	// The encoder which creates the frames
+	encodedAudio
+	// The audio which is being encoded
+	audio *deezer.Audio
+	// The temporary file which the frames are written in
+	file   *os.File
+	writer *bufio.Writer
+	// The path which the file is moved to after all frames are written
+	path string
+	// True if the encoder returned io.EOF
+	finished bool
+	// True if the player has played all frames. See finishEncoding
+	complete bool
+	// True if the frames could not be written in file
+	failed bool
+	// True if Cleanup is called. The frames are not written after that
+	closed bool
+	mu     sync.Mutex
+}
+
+// OpusFrame reads the next frame from encoder and writes it in file
+func (s *storingFrames) OpusFrame() ([]byte, error) {
+	frame, err := s.encodedAudio.OpusFrame()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return frame, err
+	}
+	if err == io.EOF {
+		s.finished = true
+	}
+	if err != nil || s.failed {
+		return frame, err
+	}
+	// Write the frame like DCA frames
+	if err := binary.Write(s.writer, binary.LittleEndian, int16(len(frame))); err != nil {
+		s.failed = true
+	} else if _, err = s.writer.Write(frame); err != nil {
+		s.failed = true
+	}
+	return frame, nil
+}
+
+// markComplete marks that all frames of the stream were played
+func (s *storingFrames) markComplete() {
+	s.mu.Lock()
+	s.complete = true
+	s.mu.Unlock()
+}
+
+// Cleanup stops the encoder and moves the file to its path if all frames are stored in it
+func (s *storingFrames) Cleanup() {
+	// Stop writing before the encoder is killed, so a frame which is read after that is not stored
+	s.mu.Lock()
+	s.closed = true
+	keep := s.complete && s.finished && !s.failed
+	s.mu.Unlock()
+	s.encodedAudio.Cleanup()
+	err := s.writer.Flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if encoder, ok := s.encodedAudio.(interface{ Error() error }); ok && err == nil {
+		err = encoder.Error()
+	}
+	if !keep || err != nil {
+		_ = os.Remove(s.file.Name())
+		return
+	}
+	if err = os.Rename(s.file.Name(), s.path); err != nil {
+		_ = os.Remove(s.file.Name())
+		return
+	}
+	s.audio.AddSidecar(s.path)
+}
+
+// streamingFrames encodes an audio which is piped to ffmpeg
+type streamingFrames struct {
+	*dca.EncodeSession
+	// The reader which is piped to ffmpeg
+	reader io.Closer
+}
+
+// Cleanup stops the encoder and closes the reader
+func (s *streamingFrames) Cleanup() {
+	// The reader must be closed first, because ffmpeg does not exit while the reader is waiting for data
+	_ = s.reader.Close()
+	s.EncodeSession.Cleanup()
+}
+
+// watchedFrames records the time which the last frame is read from an encodedAudio
+// It's used to find the stuck encoders
+type watchedFrames struct {
+	encodedAudio
+	lastFrame time.Time
+	mu        sync.Mutex
+}
+
+// OpusFrame reads the next frame and records its time
+func (w *watchedFrames) OpusFrame() ([]byte, error) {
+	frame, err := w.encodedAudio.OpusFrame()
+	w.Touch()
+	return frame, err
+}
+
+// Touch resets the time of last frame to now
+func (w *watchedFrames) Touch() {
+	w.mu.Lock()
+	w.lastFrame = time.Now()
+	w.mu.Unlock()
+}
+
+// SinceLastFrame returns the time which is passed since the last frame
+func (w *watchedFrames) SinceLastFrame() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.lastFrame)
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEncoder creates count frames, or frames until it's cleaned up if count is negative
+// A killed encoder returns io.EOF like a finished one.
+type fakeEncoder struct {
+	count   int
+	created int
+	killed  bool
+	mu      sync.Mutex
+}
+
+func (e *fakeEncoder) OpusFrame() ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.killed || (e.count >= 0 && e.created >= e.count) {
+		return nil, io.EOF
+	}
+	e.created++
+	return []byte{byte(e.created), 1, 2, 3}, nil
+}
+
+func (e *fakeEncoder) FrameDuration() time.Duration {
+	return 20 * time.Millisecond
+}
+
+func (e *fakeEncoder) Cleanup() {
+	e.mu.Lock()
+	e.killed = true
+	e.mu.Unlock()
+}
+
+// newTestStoringFrames creates storingFrames which store the frames of encoder in a temporary directory
+func newTestStoringFrames(t *testing.T, encoder encodedAudio) *storingFrames {
+	directory := t.TempDir()
+	file, err := os.CreateTemp(directory, deezer.PartialFilePattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &storingFrames{
+		encodedAudio: encoder,
+		audio:        &deezer.Audio{},
+		file:         file,
+		writer:       bufio.NewWriter(file),
+		path:         filepath.Join(directory, "opus.dca"),
+	}
+}
+
+// readFrames reads the frames until an error like the stream of dca and returns their count
+func readFrames(frames encodedAudio) int {
+	count := 0
+	for {
+		if _, err := frames.OpusFrame(); err != nil {
+			return count
+		}
+		count++
+	}
+}
+
+func TestStoringFramesComplete(t *testing.T) {
+	frames := newTestStoringFrames(t, &fakeEncoder{count: 5})
+	if count := readFrames(frames); count != 5 {
+		t.Fatalf("expected 5 frames, got %d", count)
+	}
+	finishEncoding(frames, true)
+	file, err := os.Open(frames.path)
+	if err != nil {
+		t.Fatal("frames are not stored:", err)
+	}
+	defer file.Close()
+	stored := &storedFrames{file: file, reader: bufio.NewReader(file)}
+	for i := 1; i <= 5; i++ {
+		frame, err := stored.OpusFrame()
+		if err != nil || len(frame) != 4 || frame[0] != byte(i) {
+			t.Fatalf("unexpected frame %d: %v %v", i, frame, err)
+		}
+	}
+	if _, err = stored.OpusFrame(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the frames, got %v", err)
+	}
+}
+
+func TestStoringFramesSkipped(t *testing.T) {
+	frames := newTestStoringFrames(t, &fakeEncoder{count: -1})
+	// The stream keeps reading the frames while the track is skipped
+	read := make(chan int)
+	go func() {
+		read <- readFrames(frames)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	finishEncoding(frames, false)
+	select {
+	case <-read:
+	case <-time.After(time.Second):
+		t.Fatal("stream is not stopped after cleanup")
+	}
+	if fileExists(frames.path) {
+		t.Fatal("frames of a skipped track are stored")
+	}
+	if fileExists(frames.file.Name()) {
+		t.Fatal("temporary file is not removed")
+	}
+}
+
+func TestStoringFramesNotFinished(t *testing.T) {
+	// The stream might end without error of the encoder, so being complete is not enough
+	frames := newTestStoringFrames(t, &fakeEncoder{count: 5})
+	_, _ = frames.OpusFrame()
+	finishEncoding(frames, true)
+	if fileExists(frames.path) {
+		t.Fatal("frames are stored before the encoder is finished")
+	}
+}
+
+// fileExists checks if a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandContext is the place which a command is executed in
+// Both the prefix commands and the application commands are converted to this
+type commandContext struct {
+	// The discord session
+	session *discordgo.Session
+	// The guild which the command is executed in
+	guild *discordgo.Guild
+	// The text channel which the command is executed in
+	channelID string
+	// The user who executed the command
+	userID string
+	// The message of command. Empty for application commands
+	messageID string
+	// The permissions of the user in the text channel
+	permissions int64
+	// reply sends a reply to the command
+	reply func(content string) (*discordgo.Message, error)
+}
+
+// executeCommand runs a command in a context after checking the permissions of the user
+func executeCommand(ctx commandContext, command *Command, args commandArgs) {
+	if command.OwnerOnly && (ownerID == "" || ctx.userID != ownerID) {
+		_, _ = ctx.reply("Only the owner of bot can use this command")
+		return
+	}
+	if ctx.permissions&command.Permissions != command.Permissions {
+		_, _ = ctx.reply("You don't have the permission to use this command")
+		return
+	}
+	command.Handler(ctx, args)
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"sync"
+	"time"
+)
+
+// pendingSearchTimeout is the time which a search result can be picked by the user
+const pendingSearchTimeout = 5 * time.Minute
+
+// numberEmojis are the reactions which can be used to pick a search result
+// The index of each emoji is the index of search result
+var numberEmojis = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣"}
+
+// PendingSearches is a list of searches which their results can be picked by the user who searched them
+type PendingSearches struct {
+	// Searches mapped from the channel and the user who searched them
+	searches map[pendingSearchKey]*pendingSearch
+	// Searches mapped from the ID of the message which contains the results
+	messages map[string]*pendingSearch
+	mu       sync.Mutex
+}
+
+// pendingSearchKey identifies the last search of a user in a channel
+type pendingSearchKey struct {
+	channelID string
+	userID    string
+}
+
+// pendingSearch is a search which its results can be picked
+type pendingSearch struct {
+	// The key of this search in PendingSearches.searches
+	key pendingSearchKey
+	// The ID of message which contains the results
+	messageID string
+	// The results of search
+	results []deezer.SearchResult
+	// When will this search expire
+	expires time.Time
+}
+
+// cleanupExpiredSearches removes the searches which cannot be picked anymore
+func (p *PendingSearches) cleanupExpiredSearches() {
+	for {
+		time.Sleep(time.Minute)
+		now := time.Now()
+		p.mu.Lock()
+		for key, search := range p.searches {
+			if now.After(search.expires) {
+				delete(p.searches, key)
+				delete(p.messages, search.messageID)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Add registers the results of a search which is done by a user in a channel
+// It replaces the previous search of the user in that channel
+func (p *PendingSearches) Add(channelID, userID, messageID string, results []deezer.SearchResult) {
+	search := &pendingSearch{
+		key:       pendingSearchKey{channelID: channelID, userID: userID},
+		messageID: messageID,
+		results:   results,
+		expires:   time.Now().Add(pendingSearchTimeout),
+	}
+	p.mu.Lock()
+	if old, exists := p.searches[search.key]; exists {
+		delete(p.messages, old.messageID)
+	}
+	p.searches[search.key] = search
+	p.messages[messageID] = search
+	p.mu.Unlock()
+}
+
+// Pick gets the nth result of the last search of a user in a channel
+// The index starts at 1
+func (p *PendingSearches) Pick(channelID, userID string, index int) (result deezer.SearchResult, ok bool) {
+	p.mu.Lock()
+	search, exists := p.searches[pendingSearchKey{channelID: channelID, userID: userID}]
+	if exists {
+		result, ok = search.pick(index)
+	}
+	p.mu.Unlock()
+	return
+}
+
+// PickByMessage gets the nth result of a search by the ID of its message
+// Only the user who searched can pick the result
+// The index starts at 1
+func (p *PendingSearches) PickByMessage(messageID, userID string, index int) (result deezer.SearchResult, ok bool) {
+	p.mu.Lock()
+	search, exists := p.messages[messageID]
+	if exists && search.key.userID == userID {
+		result, ok = search.pick(index)
+	}
+	p.mu.Unlock()
+	return
+}
+
+// pick gets the nth result of search if the search is not expired
+// The index starts at 1
+func (s *pendingSearch) pick(index int) (result deezer.SearchResult, ok bool) {
+	if time.Now().After(s.expires) || index <= 0 || index > len(s.results) {
+		return
+	}
+	return s.results[index-1], true
+}
+
+// emojiIndex gets the index of a number emoji
+// The index starts at 1 and -1 is returned if the emoji is not a number emoji
+func emojiIndex(emoji string) int {
+	for i, numberEmoji := range numberEmojis {
+		if numberEmoji == emoji {
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"container/list"
+	"context"
+	"strconv"
+)
+
+// maxDownloadStatuses is the number of unread statuses which a download job keeps
+const maxDownloadStatuses = 4
+
+// downloadJob is a download which runs in background
+type downloadJob struct {
+	// The queue element which is being downloaded. Its value is a deezer.Track
+	element *list.Element
+	// stop cancels the context of download
+	stop context.CancelFunc
+	// done is closed when the download is finished
+	done chan struct{}
+	// The scheduling options of download
+	request *deezer.DownloadRequest
+	// status receives the messages about the progress of download, like its position in the download queue
+	status chan string
+	// The result of download. Only valid after done is closed
+	audio *deezer.Audio
+	err   error
+}
+
+// startDownload starts downloading a queued track with a downloader in background
+func startDownload(downloader deezer.Downloader, element *list.Element, quality deezer.Quality, priority deezer.DownloadPriority) *downloadJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &downloadJob{
+		element: element,
+		stop:    cancel,
+		done:    make(chan struct{}),
+		status:  make(chan string, maxDownloadStatuses),
+	}
+	job.request = deezer.NewDownloadRequest(priority)
+	job.request.OnQueued = func(position int) {
+		job.setStatus("Waiting for other downloads to finish. Position in download queue: " + strconv.Itoa(position))
+	}
+	job.request.OnRetry = func(attempt, attempts int, _ error) {
+		job.setStatus("Retrying download " + strconv.Itoa(attempt) + "/" + strconv.Itoa(attempts) + "…")
+	}
+	ctx = deezer.WithDownloadRequest(ctx, job.request)
+	track := element.Value.(deezer.Track)
+	go func() {
+		job.audio, job.err = downloader.Download(ctx, track, quality)
+		close(job.done)
+	}()
+	return job
+}
+
+// setStatus reports the progress of download
+// The status is dropped if there are too many unread statuses
+func (j *downloadJob) setStatus(status string) {
+	select {
+	case j.status <- status:
+	default:
+	}
+}
+
+// Cancel stops the download and releases the downloaded audio when the download is finished
+// The result of job must not be used after calling this
+func (j *downloadJob) Cancel() {
+	j.stop()
+	go func() {
+		<-j.done
+		if j.audio != nil {
+			j.audio.Close()
+		}
+	}()
+}
+
+// refreshPrefetch makes sure that the prefetched track is the next track in queue
+// If it's not, the prefetch is cancelled and the next track is prefetched if a track is streaming
+// s.mu must be locked when calling this function
+func (s *ServerState) refreshPrefetch() {
+	var next *list.Element
+	if front := s.queue.Front(); front != nil {
+		next = front.Next()
+	}
+	if s.prefetch != nil && s.prefetch.element == next {
+		return
+	}
+	s.cancelPrefetch()
+	// Only prefetch when the current track is already playing
+	if next != nil && s.session != nil {
+		s.prefetch = startDownload(s.downloader, next, guildQuality(s.guildID), deezer.PriorityPrefetch)
+	}
+}
+
+// cancelPrefetch cancels the prefetch job if it exists
+// s.mu must be locked when calling this function
+func (s *ServerState) cancelPrefetch() {
+	if s.prefetch != nil {
+		s.prefetch.Cancel()
+		s.prefetch = nil
+	}
+}
+
+// StopPrefetch cancels the prefetch job if it exists
+func (s *ServerState) StopPrefetch() {
+	s.mu.Lock()
+	s.cancelPrefetch()
+	s.mu.Unlock()
+}
+
+// downloadPlayingTrack gets the download job of the track which is playing now
+// If the track is prefetched, the prefetch job is returned. Otherwise, a new download is started.
+// It returns nil if the queue is empty
+func (s *ServerState) downloadPlayingTrack() *downloadJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	front := s.queue.Front()
+	if front == nil {
+		return nil
+	}
+	if s.prefetch != nil && s.prefetch.element == front {
+		job := s.prefetch
+		s.prefetch = nil
+		// The prefetched track is needed now
+		job.request.SetPriority(deezer.PriorityNow)
+		return job
+	}
+	return startDownload(s.downloader, front, guildQuality(s.guildID), deezer.PriorityNow)
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"Deemix-Discord-Bot/deezer"
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestServer creates a server which downloads its tracks with a downloader
+func newTestServer(downloader deezer.Downloader, tracks ...deezer.Track) *ServerState {
+	server := &ServerState{
+		stopChan:   make(chan struct{}, 1),
+		skipChan:   make(chan struct{}, 1),
+		queue:      list.New(),
+		downloader: downloader,
+	}
+	for _, track := range tracks {
+		server.queue.PushBack(track)
+	}
+	return server
+}
+
+func TestDownloadTrack(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"1.mp3", "2.mp3"} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte("audio"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestServer(deezer.LocalDownloader{Directory: directory}, deezer.Track{ID: 2}, deezer.Track{ID: 1})
+	audio, stopped, err := downloadTrack(nil, server, "")
+	if err != nil || stopped {
+		t.Fatalf("unexpected result %v %v", stopped, err)
+	}
+	defer audio.Close()
+	if audio.Path != filepath.Join(directory, "2.mp3") {
+		t.Fatalf("expected the first track of queue, got %s", audio.Path)
+	}
+	// Nothing can be downloaded from an empty queue
+	if _, _, err = downloadTrack(nil, newTestServer(deezer.LocalDownloader{Directory: directory}), ""); err != deezer.MusicNotFoundError {
+		t.Fatalf("expected MusicNotFoundError, got %v", err)
+	}
+}
+
+// stuckDownloader is a Downloader which never finishes until its download is cancelled
+type stuckDownloader struct{}
+
+func (stuckDownloader) Download(ctx context.Context, _ deezer.Track, _ deezer.Quality) (*deezer.Audio, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestDownloadTrackStopped(t *testing.T) {
+	server := newTestServer(stuckDownloader{}, deezer.Track{ID: 1})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		server.stopChan <- struct{}{}
+	}()
+	_, stopped, _ := downloadTrack(nil, server, "")
+	if !stopped {
+		t.Fatal("download is not stopped with the server")
+	}
+}
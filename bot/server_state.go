@@ -28,8 +28,14 @@ type ServerState struct {
 	queue *list.List
 	// The voice session
 	session *dca.StreamingSession
+	// The downloader which the tracks of this server are downloaded with
+	downloader deezer.Downloader
+	// The download of the next track in queue which runs while the current track is playing
+	prefetch *downloadJob
 	// When was the music player paused
 	pausedTime time.Time
+	// The ID of the guild which this server is
+	guildID string
 	// The channelID which the bot has joined
 	channelID string
 	// Mutex to lock the server state
@@ -77,9 +83,9 @@ func (s *ServersState) Skip(guildID string) (skipped bool) {
 }
 
 // Play registers a server as playing and returns the ServerState which corresponds to this server
-// If the server exists, it will add the "track" to it's queue
+// If the server exists, it will add the "tracks" to it's queue in order
 // If the server does not exist, it will initialize the server object
-func (s *ServersState) Play(guildID, voiceChannelID string, track deezer.Track) (state *ServerState, newServer bool) {
+func (s *ServersState) Play(guildID, voiceChannelID string, tracks ...deezer.Track) (state *ServerState, newServer bool) {
 	s.mu.Lock()
 	state, exists := s.servers[guildID]
 	if !exists {
@@ -89,13 +95,20 @@ func (s *ServersState) Play(guildID, voiceChannelID string, track deezer.Track)
 			skipChan: make(chan struct{}, math.MaxInt32),
 			// We also create a linked list to add the track
 			queue: list.New(),
-			// Add the channel ID
-			channelID: voiceChannelID,
+			// Add the guild and channel ID
+			guildID:    guildID,
+			channelID:  voiceChannelID,
+			downloader: downloader,
 		}
 		s.servers[guildID] = state
 	}
 	// State is always initialized here
-	state.queue.PushBack(track)
+	state.mu.Lock()
+	for _, track := range tracks {
+		state.queue.PushBack(track)
+	}
+	state.refreshPrefetch()
+	state.mu.Unlock()
 	s.mu.Unlock()
 	return state, !exists
 }
@@ -123,7 +136,7 @@ func (s *ServersState) GetQueueText(guildID string) string {
 			i++
 			queue.WriteString(strconv.Itoa(i))
 			queue.WriteString(". ")
-			queue.WriteString(head.Value.(deezer.Track).String())
+			queue.WriteString(head.Value.(deezer.Track).Summary())
 			queue.WriteByte('\n')
 		}
 		server.mu.RUnlock()
@@ -167,6 +180,7 @@ func (s *ServersState) RemoveQueuedTrack(guildID string, index int) (ok bool) {
 		}
 		index--
 	}
+	server.refreshPrefetch()
 	server.mu.Unlock()
 	return true
 }
@@ -188,6 +202,7 @@ func (s *ServersState) Pop(guildID string) (ok bool) {
 		server.stopChan <- struct{}{}
 	} else {
 		server.queue.Remove(server.queue.Back())
+		server.refreshPrefetch()
 	}
 	server.mu.Unlock()
 	return true
@@ -261,9 +276,11 @@ func (s *ServerState) GetPlayingTrack() (track deezer.Track, exists bool) {
 }
 
 // SetVoiceSession sets the voice session of a server
+// The next track in queue is prefetched while this session is playing
 func (s *ServerState) SetVoiceSession(session *dca.StreamingSession) {
 	s.mu.Lock()
 	s.session = session
+	s.refreshPrefetch()
 	s.mu.Unlock()
 }
 
@@ -1,4 +1,26 @@
 package bot
 
+import "Deemix-Discord-Bot/deezer"
+
 // serverList contains the list of all servers which are currently playing music
 var serverList = ServersState{servers: make(map[string]*ServerState)}
+
+// searchList contains the searches which their results can be picked
+var searchList = PendingSearches{
+	searches: make(map[pendingSearchKey]*pendingSearch),
+	messages: make(map[string]*pendingSearch),
+}
+
+// autocompleteState contains the latest autocomplete requests of users
+var autocompleteState = AutocompleteState{
+	latest: make(map[string]autocompleteRequest),
+}
+
+// deezerClient is used to get the tracks from deezer
+var deezerClient = deezer.NewClient()
+
+// downloader is used to download the tracks before playing them
+var downloader deezer.Downloader
+
+// deemixConfig is the config directory of deemix which holds the ARL of bot
+var deemixConfig *deezer.DeemixConfig
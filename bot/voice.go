@@ -1,32 +1,69 @@
 package bot
 
 import (
+	"Deemix-Discord-Bot/config"
 	"Deemix-Discord-Bot/deezer"
+	"Deemix-Discord-Bot/util"
+	"context"
 	"github.com/bwmarrin/discordgo"
 	"github.com/jonas747/dca"
 	"io"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// encodeCheckInterval is the interval which the encoder is checked for being stuck
+const encodeCheckInterval = time.Second
+
+// matchProgressMinTracks is the minimum number of spotify tracks which their matching progress is shown in chat
+const matchProgressMinTracks = 20
+
+// matchProgressInterval is the minimum time between the updates of matching progress message
+const matchProgressInterval = 3 * time.Second
+
+// defaultArtistTopTracks is the number of top tracks of an artist which are queued if the user doesn't specify it
+const defaultArtistTopTracks = 10
+
 // playMusic might initialize a voice connection to start playing the music,
 // or it might just push the track to queue
-func playMusic(s *discordgo.Session, guildID, voiceChannelID, textChannelID, text string) {
+// count is the number of top tracks which are played if the text is an artist link. It's limited by
+// config.Config.MaxPlaylistTracks
+func playMusic(s *discordgo.Session, guildID, voiceChannelID, textChannelID, text string, count int) {
+	if count > config.Config.MaxPlaylistTracks {
+		count = config.Config.MaxPlaylistTracks
+	}
 	// Get the track info or search and get the track info
-	track, err := deezer.KeywordToLink(text)
+	tracks, err := deezerClient.KeywordToTracks(text, deezer.LinkOptions{
+		MaxPlaylistTracks: config.Config.MaxPlaylistTracks,
+		ArtistTopTracks:   count,
+		OnProgress:        matchProgressReporter(s, textChannelID),
+	})
 	if err != nil {
 		_, _ = s.ChannelMessageSend(textChannelID, "Cannot play this music: "+err.Error())
 		return
 	}
-	// Add the track to server queue
-	serverState, newServer := serverList.Play(guildID, voiceChannelID, track)
+	// Add the tracks to server queue
+	serverState, newServer := serverList.Play(guildID, voiceChannelID, tracks.Tracks...)
+	if tracks.IsCollection() { // Send a single message for all of the tracks
+		message := "Queued " + strconv.Itoa(len(tracks.Tracks)) + " tracks from " + tracks.Name
+		if tracks.Missing != 0 {
+			message += " (" + strconv.Itoa(tracks.Missing) + " tracks were not found in deezer)"
+		}
+		_, _ = s.ChannelMessageSend(textChannelID, message)
+	}
 	if !newServer { // If this server is playing a music just send the info about queue and do nothing
-		_, _ = s.ChannelMessageSend(textChannelID, "Queued "+track.String())
+		if !tracks.IsCollection() {
+			_, _ = s.ChannelMessageSend(textChannelID, "Queued "+tracks.Tracks[0].Summary())
+		}
 		return
 	}
 	// So if we reach this line, we can understand that this goroutine will be used to stream
 	// the music to Discord
 	// So when this goroutine is killed, we have to remove the server from this list
 	defer serverList.DeleteServer(guildID)
+	defer serverState.StopPrefetch()
 	// Join the channel
 	vc, err := s.ChannelVoiceJoin(guildID, voiceChannelID, false, true)
 	if err != nil {
@@ -49,22 +86,126 @@ func playMusic(s *discordgo.Session, guildID, voiceChannelID, textChannelID, tex
 	}
 }
 
+// matchProgressReporter creates a function which shows the progress of matching spotify tracks in a text channel
+// It sends a message for the long collections and edits it every matchProgressInterval, because matching
+// them might take a while when the quota of deezer is exceeded
+func matchProgressReporter(s *discordgo.Session, textChannelID string) func(matched, total int) {
+	var message *discordgo.Message
+	var lastUpdate time.Time
+	return func(matched, total int) {
+		if total < matchProgressMinTracks {
+			return
+		}
+		if matched != total && time.Since(lastUpdate) < matchProgressInterval {
+			return
+		}
+		lastUpdate = time.Now()
+		text := "Finding the spotify tracks in deezer: " + strconv.Itoa(matched) + "/" + strconv.Itoa(total)
+		if message == nil {
+			message, _ = s.ChannelMessageSend(textChannelID, text)
+		} else {
+			_, _ = s.ChannelMessageEdit(textChannelID, message.ID, text)
+		}
+	}
+}
+
+// splitTrackCount splits the optional track count from the end of a link
+// For example "https://www.deezer.com/artist/27 5" results in the link and 5
+// If the count is not given or is invalid, defaultArtistTopTracks is returned as count
+func splitTrackCount(text string) (string, int) {
+	count := defaultArtistTopTracks
+	fields := strings.Fields(text)
+	if len(fields) == 2 && util.IsUrl(fields[0]) {
+		if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+			text = fields[0]
+			count = n
+		}
+	}
+	return text, count
+}
+
+// guildQuality gets the quality which the tracks of a guild must be downloaded in
+func guildQuality(guildID string) deezer.Quality {
+	if quality, exists := config.Config.GuildQualities[guildID]; exists {
+		return deezer.Quality(quality)
+	}
+	return deezer.Quality(config.Config.Quality)
+}
+
+// downloadTrack downloads the track which is playing now and cancels the download if the server is stopped
+// The prefetched download is used if it exists
+// The progress of download, like its position in the download queue or its retries, is sent to the text channel
+// stopped is true if the server was stopped while downloading
+func downloadTrack(s *discordgo.Session, serverState *ServerState, textChannelID string) (audio *deezer.Audio, stopped bool, err error) {
+	job := serverState.downloadPlayingTrack()
+	if job == nil {
+		return nil, false, deezer.MusicNotFoundError
+	}
+	for {
+		select {
+		case <-job.done:
+			return job.audio, false, job.err
+		case status := <-job.status:
+			_, _ = s.ChannelMessageSend(textChannelID, status)
+		case <-serverState.stopChan:
+			job.Cancel()
+			return nil, true, context.Canceled
+		}
+	}
+}
+
+// downloadErrorMessage explains why a track could not be downloaded to the users
+func downloadErrorMessage(err error) string {
+	switch err {
+	case deezer.MusicNotFoundError:
+		return "Music not found"
+	case deezer.InvalidArlError:
+		return "Cannot download the music because the deezer account of bot is logged out. The ARL is invalid or expired."
+	case deezer.RegionUnavailableError:
+		return "This music is not available in the country of bot's deezer account"
+	case deezer.QualityUnavailableError:
+		return "This music cannot be downloaded with bot's deezer account in any quality"
+	case deezer.NetworkError:
+		return "Cannot connect to deezer to download the music"
+	default:
+		return "Cannot download the music"
+	}
+}
+
+// reportDownloadError sends the reason of a failed download to the text channel
+// The queue must be stopped if shouldStop is true. This happens when all ARLs are invalid, because none of the
+// other tracks can be downloaded either. For the other errors, the next track can be played.
+func reportDownloadError(s *discordgo.Session, textChannelID string, err error) (shouldStop bool) {
+	if err == deezer.InvalidArlError {
+		if arls.rotate() {
+			_, _ = s.ChannelMessageSend(textChannelID, downloadErrorMessage(err)+" The next ARL is used from now on.")
+			return false
+		}
+		_, _ = s.ChannelMessageSend(textChannelID, downloadErrorMessage(err)+" The queue is stopped.")
+		return true
+	}
+	_, _ = s.ChannelMessageSend(textChannelID, downloadErrorMessage(err))
+	return false
+}
+
 // playMusicInVoice plays a music in a voice channel
 func playMusicInVoice(s *discordgo.Session, vc *discordgo.VoiceConnection, serverState *ServerState, textChannelID string, track deezer.Track) (shouldStop bool) {
-	_, _ = s.ChannelMessageSend(textChannelID, "Now playing "+track.String())
+	_, _ = s.ChannelMessageSend(textChannelID, "Now playing "+track.Summary())
 	// Download the music
-	tempDir, err := deezer.Download(track.Link, serverState.stopChan)
-	if err != nil {
-		log.Println("cannot download the music from deezer:", err)
+	audio, stopped, err := downloadTrack(s, serverState, textChannelID)
+	// Try again with the next ARL if the current one is expired
+	if err == deezer.InvalidArlError && arls.rotate() {
+		_, _ = s.ChannelMessageSend(textChannelID, "The deezer ARL of bot is expired. Trying again with the next one...")
+		audio, stopped, err = downloadTrack(s, serverState, textChannelID)
+	}
+	if stopped {
 		return true
 	}
-	defer tempDir.Delete()
-	// Check downloaded file
-	musics := tempDir.GetMusics()
-	if len(musics) == 0 {
-		_, _ = s.ChannelMessageSend(textChannelID, "Music not found")
-		return false
+	if err != nil {
+		log.Println("cannot download the music:", err)
+		return reportDownloadError(s, textChannelID, err)
 	}
+	defer audio.Close()
 	// Start streaming
 	_ = vc.Speaking(true)
 	defer func(vc *discordgo.VoiceConnection) {
@@ -72,23 +213,49 @@ func playMusicInVoice(s *discordgo.Session, vc *discordgo.VoiceConnection, serve
 	}(vc)
 	// Play it
 	done := make(chan error, 1)
-	encodeSession, err := dca.EncodeFile(musics[0], dca.StdEncodeOptions)
+	encodeSession, err := encodeAudio(audio, dca.StdEncodeOptions)
 	if err != nil {
-		log.Println("cannot encode:", encodeSession)
+		log.Println("cannot encode:", err)
 		return false
 	}
-	defer encodeSession.Cleanup()
+	// The encoded frames are stored only if the track is played to the end
+	complete := false
+	defer func() {
+		finishEncoding(encodeSession, complete)
+	}()
+	frames := &watchedFrames{encodedAudio: encodeSession, lastFrame: time.Now()}
 	// Create a stream
-	stream := dca.NewStream(encodeSession, vc, done)
+	stream := dca.NewStream(frames, vc, done)
 	serverState.SetVoiceSession(stream)
 	defer serverState.RemoveVoiceSession()
 	// Wait either the stream is done, or the bot is stopped
-	select {
-	case err = <-done:
-	case <-serverState.stopChan:
-		return true
-	case <-serverState.skipChan:
-		return false
+	encodeTimeout := time.Duration(config.Config.EncodeTimeoutSeconds) * time.Second
+	ticker := time.NewTicker(encodeCheckInterval)
+	defer ticker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case err = <-done:
+			waiting = false
+		case <-serverState.stopChan:
+			return true
+		case <-serverState.skipChan:
+			return false
+		case <-ticker.C:
+			// The encoder is not stuck if there is no need for frames or the data is not downloaded yet
+			if stream.Paused() || audio.Downloading() {
+				frames.Touch()
+			} else if frames.SinceLastFrame() > encodeTimeout {
+				log.Println("encoding timed out:", track.Link)
+				_, _ = s.ChannelMessageSend(textChannelID, "Encoding the music timed out")
+				return false
+			}
+		}
+	}
+	complete = err == io.EOF && audio.DownloadError() == nil
+	// The download might be failed after we started playing it
+	if downloadErr := audio.DownloadError(); downloadErr != nil {
+		log.Println("cannot download the rest of music:", downloadErr)
+		return reportDownloadError(s, textChannelID, downloadErr)
 	}
 	if err != nil && err != io.EOF {
 		log.Println("there was a problem streaming the song:", err)
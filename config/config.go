@@ -4,19 +4,57 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strings"
 )
 
 const Version = "0.3.0"
 const Repo = "https://github.com/HirbodBehnam/Deemix-Discord-Bot"
 
-var HelpMessage string
-
 // Config is the config of application
 var Config struct {
 	// Token of discord
 	Token string `json:"token"`
 	// Prefix of bot commands
 	Prefix string `json:"prefix"`
+	// If true (default), the messages are read to run the prefix commands
+	// The message content intent must be enabled in discord developer portal for this
+	PrefixCommands bool `json:"prefix_commands"`
+	// The ARL cookie of deezer account which deemix uses. DEEMIX_ARL environment variable overrides it
+	Arl string `json:"arl"`
+	// The ARLs of other deezer accounts which are used one after another when Arl expires
+	Arls []string `json:"arls"`
+	// The maximum number of tracks which a single playlist can add to queue
+	MaxPlaylistTracks int `json:"max_playlist_tracks"`
+	// Client ID of spotify application. Used to play spotify links
+	SpotifyClientID string `json:"spotify_client_id"`
+	// Client secret of spotify application. Used to play spotify links
+	SpotifyClientSecret string `json:"spotify_client_secret"`
+	// The backend which downloads the tracks. Either "deemix" (default) or "local"
+	Downloader string `json:"downloader"`
+	// The directory of audio files which "local" downloader serves
+	LocalMusicDirectory string `json:"local_music_directory"`
+	// The maximum number of tracks which are downloaded at once in all guilds
+	DownloadWorkers int `json:"download_workers"`
+	// The maximum time which a download can take until the track can be played in seconds
+	DownloadTimeoutSeconds int `json:"download_timeout_seconds"`
+	// The number of times which a download is retried if it fails with a network error or timeout
+	DownloadRetries int `json:"download_retries"`
+	// The maximum time which the encoder can take to produce the next frame in seconds
+	EncodeTimeoutSeconds int `json:"encode_timeout_seconds"`
+	// The quality which the tracks are downloaded in. Either "128" (default), "320" or "flac"
+	Quality string `json:"quality"`
+	// The quality of each guild which overrides Quality. It maps the guild ID to quality
+	GuildQualities map[string]string `json:"guild_qualities"`
+	// The directory which the downloaded tracks are cached in. Caching is disabled if empty
+	CacheDirectory string `json:"cache_directory"`
+	// The maximum size of cache directory in megabytes
+	CacheSizeMB int64 `json:"cache_size_mb"`
+	// The maximum number of deezer search results and tracks which are kept in memory
+	SearchCacheSize int `json:"search_cache_size"`
+	// The time which the deezer search results and tracks are kept in memory in minutes
+	SearchCacheTTLMinutes int `json:"search_cache_ttl_minutes"`
+	// Custom command aliases of each guild. It maps the guild ID to a map of alias to command name
+	Aliases map[string]map[string]string `json:"aliases"`
 }
 
 // LoadConfig reads the config file from disk
@@ -25,24 +63,67 @@ func LoadConfig(location string) {
 	if err != nil {
 		log.Fatalf("Cannot read config file: %s\n", err)
 	}
+	// Prefix commands are enabled unless the config disables them
+	Config.PrefixCommands = true
 	err = json.Unmarshal(bytes, &Config)
 	if err != nil {
 		log.Fatalf("Cannot parse config file: %s\n", err)
 	}
+	// Read the ARL from environment
+	if arl := os.Getenv("DEEMIX_ARL"); arl != "" {
+		Config.Arl = arl
+	}
 	// Fix prefix
 	if Config.Prefix == "" {
 		Config.Prefix = "?"
 	}
-	// Fix help message
-	HelpMessage = "Welcome to my private music bot v" + Version + ". Here are the list of commands which you can use:\n" +
-		Config.Prefix + "help : Show this message again\n" +
-		Config.Prefix + "play <link>/<keyword> : Play a song from deezer or search and play a song from deezer.\n" +
-		Config.Prefix + "skip : Skip the current song\n" +
-		Config.Prefix + "queue : Show the queue\n" +
-		Config.Prefix + "remove <index> : Removes the nth track from queue\n" +
-		Config.Prefix + "pop : Removes the last track from queue\n" +
-		Config.Prefix + "playing : Show playing song name\n" +
-		Config.Prefix + "search <keyword> : Search a track in deezer\n" +
-		Config.Prefix + "stop : Stops the playing music\n" +
-		Config.Prefix + "repo : Show the source code"
+	// Fix qualities
+	if Config.Quality == "" {
+		Config.Quality = "128"
+	}
+	Config.Quality = strings.ToLower(Config.Quality)
+	for guildID, quality := range Config.GuildQualities {
+		Config.GuildQualities[guildID] = strings.ToLower(quality)
+	}
+	// Fix download workers
+	if Config.DownloadWorkers <= 0 {
+		Config.DownloadWorkers = 2
+	}
+	// Fix timeouts and retries
+	if Config.DownloadTimeoutSeconds <= 0 {
+		Config.DownloadTimeoutSeconds = 300
+	}
+	if Config.EncodeTimeoutSeconds <= 0 {
+		Config.EncodeTimeoutSeconds = 30
+	}
+	if Config.DownloadRetries == 0 {
+		Config.DownloadRetries = 2
+	} else if Config.DownloadRetries < 0 { // Disabled
+		Config.DownloadRetries = 0
+	}
+	// Fix cache size
+	if Config.CacheSizeMB <= 0 {
+		Config.CacheSizeMB = 1024
+	}
+	// Fix search cache
+	if Config.SearchCacheSize == 0 {
+		Config.SearchCacheSize = 1000
+	} else if Config.SearchCacheSize < 0 { // Disabled
+		Config.SearchCacheSize = 0
+	}
+	if Config.SearchCacheTTLMinutes <= 0 {
+		Config.SearchCacheTTLMinutes = 10
+	}
+	// Aliases are not case-sensitive
+	for guildID, aliases := range Config.Aliases {
+		lowerAliases := make(map[string]string, len(aliases))
+		for alias, command := range aliases {
+			lowerAliases[strings.ToLower(alias)] = command
+		}
+		Config.Aliases[guildID] = lowerAliases
+	}
+	// Fix playlist limit
+	if Config.MaxPlaylistTracks <= 0 {
+		Config.MaxPlaylistTracks = 100
+	}
 }
@@ -0,0 +1,61 @@
+package deezer
+
+import (
+	"errors"
+	"strconv"
+)
+
+// QuotaExceededError is returned when too many requests are sent to deezer API
+var QuotaExceededError = errors.New("deezer quota exceeded")
+
+// DataNotFoundError is returned when the requested object does not exist in deezer
+var DataNotFoundError = errors.New("not found in deezer")
+
+// ServiceBusyError is returned when deezer API is temporarily unavailable
+var ServiceBusyError = errors.New("deezer is busy")
+
+// EmptyTrackError is returned when deezer returns a track without link
+var EmptyTrackError = errors.New("deezer returned an empty track")
+
+// The codes of deezer API errors which have a dedicated error
+// See https://developers.deezer.com/api/errors
+const (
+	quotaErrorCode        = 4
+	serviceBusyErrorCode  = 700
+	dataNotFoundErrorCode = 800
+)
+
+// APIError is an error which deezer API returns and does not have a dedicated error
+type APIError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *APIError) Error() string {
+	return "deezer error " + strconv.Itoa(e.Code) + ": " + e.Message
+}
+
+// errorResponse is the body of deezer responses when there is an error
+// Deezer sends them with status 200
+type errorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// err converts the error of response to an error of this package
+// nil is returned if the response does not contain an error
+func (r errorResponse) err() error {
+	if r.Error == nil {
+		return nil
+	}
+	switch r.Error.Code {
+	case quotaErrorCode:
+		return QuotaExceededError
+	case serviceBusyErrorCode:
+		return ServiceBusyError
+	case dataNotFoundErrorCode:
+		return DataNotFoundError
+	default:
+		return r.Error
+	}
+}
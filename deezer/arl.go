@@ -0,0 +1,106 @@
+package deezer
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// userDataResponse is the response of deezer.getUserData method of gateway
+type userDataResponse struct {
+	Results struct {
+		User struct {
+			ID   int64  `json:"USER_ID"`
+			Name string `json:"BLOG_NAME"`
+		} `json:"USER"`
+	} `json:"results"`
+}
+
+// ValidateArl checks if an ARL can log in to deezer and returns the name of its user
+// InvalidArlError is returned if the ARL is invalid or expired
+func (c *Client) ValidateArl(arl string) (string, error) {
+	req, err := http.NewRequest("GET", c.GatewayURL+"?method=deezer.getUserData&input=3&api_version=1.0&api_token=", nil)
+	if err != nil {
+		return "", err
+	}
+	req.AddCookie(&http.Cookie{Name: "arl", Value: arl})
+	resp, err := c.do(req)
+	if err != nil {
+		return "", NetworkError
+	}
+	var result userDataResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	// Deezer returns the user 0 if the user is not logged in
+	if result.Results.User.ID == 0 {
+		return "", InvalidArlError
+	}
+	return result.Results.User.Name, nil
+}
+
+// DeemixConfig is a config directory of deemix which belongs to this bot
+// deemix reads its ARL from this directory instead of the config of user who runs the bot.
+// It's safe to use it from multiple goroutines.
+type DeemixConfig struct {
+	// The directory which is used as XDG_CONFIG_HOME of deemix
+	directory string
+	// True if an ARL is written in directory. deemix's own config is used until then
+	hasArl bool
+	mu     sync.RWMutex
+}
+
+// NewDeemixConfig creates a DeemixConfig in a directory
+func NewDeemixConfig(directory string) (*DeemixConfig, error) {
+	err := os.MkdirAll(filepath.Join(directory, "deemix"), 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &DeemixConfig{directory: directory}, nil
+}
+
+// SetArl writes the ARL which deemix uses to log in to deezer
+// The downloads which are started after this use the new ARL
+func (c *DeemixConfig) SetArl(arl string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Write it atomically to not break the running deemix processes
+	file, err := os.CreateTemp(filepath.Join(c.directory, "deemix"), PartialFilePattern)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(strings.TrimSpace(arl))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(c.directory, "deemix", ".arl"))
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	c.hasArl = true
+	return nil
+}
+
+// Env returns the environment variables which make deemix use this config
+// nil is returned if no ARL is set, which means that deemix's own config must be used
+func (c *DeemixConfig) Env() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.hasArl {
+		return nil
+	}
+	return append(os.Environ(), "XDG_CONFIG_HOME="+c.directory)
+}
+
+// Delete removes the config directory
+func (c *DeemixConfig) Delete() {
+	_ = os.RemoveAll(c.directory)
+}
@@ -0,0 +1,444 @@
+package deezer
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheKey identifies a cached track
+type cacheKey struct {
+	// The deezer ID of track
+	trackID int
+	// The quality of track
+	quality Quality
+}
+
+// fileName returns the name of the cached file of this key with an extension
+func (k cacheKey) fileName(ext string) string {
+	return strconv.Itoa(k.trackID) + "-" + string(k.quality) + ext
+}
+
+// sidecarPrefix returns the prefix of sidecar files of this key
+// Sidecar files are named like "<trackID>-<quality>.sidecar.<name>"
+func (k cacheKey) sidecarPrefix() string {
+	return strconv.Itoa(k.trackID) + "-" + string(k.quality) + sidecarSeparator
+}
+
+// partialFilePrefix is the prefix of the files which are being written in cache directory
+const partialFilePrefix = ".partial"
+
+// PartialFilePattern is the pattern of temporary files which are written in the cache directory
+// These files are removed when the cache is recovered
+const PartialFilePattern = partialFilePrefix + "*"
+
+// sidecarSeparator separates the key from the name of sidecar in sidecar files
+const sidecarSeparator = ".sidecar."
+
+// parseCacheFileName converts the name of a cached file or a sidecar file to its key
+func parseCacheFileName(name string) (cacheKey, bool) {
+	if sidecar := strings.Index(name, sidecarSeparator); sidecar != -1 {
+		name = name[:sidecar]
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	dash := strings.IndexByte(name, '-')
+	if dash == -1 {
+		return cacheKey{}, false
+	}
+	id, err := strconv.Atoi(name[:dash])
+	if err != nil {
+		return cacheKey{}, false
+	}
+	quality, err := ParseQuality(name[dash+1:])
+	if err != nil {
+		return cacheKey{}, false
+	}
+	return cacheKey{trackID: id, quality: quality}, true
+}
+
+// cacheEntry is a track which is stored in cache
+type cacheEntry struct {
+	key cacheKey
+	// The path of the file
+	path string
+	// The size of file and its sidecars in bytes
+	size int64
+	// The paths of sidecar files
+	sidecars []string
+	// The number of Audio objects which are using this file
+	// The entries which are in use are not evicted
+	users int
+	// The element of entry in the LRU list
+	element *list.Element
+}
+
+// pendingDownload is a download which is in progress. Other downloads of the same key wait for it
+type pendingDownload struct {
+	done chan struct{}
+}
+
+// CachedDownloader is a Downloader which keeps the downloaded tracks in a directory
+// and evicts the least recently used tracks when the directory gets too big.
+// It's safe to use it from multiple goroutines.
+type CachedDownloader struct {
+	// The downloader which downloads the tracks which are not in the cache
+	downloader Downloader
+	// The directory which the tracks are stored in
+	directory string
+	// The maximum size of directory in bytes
+	maxSize int64
+	// The current size of directory in bytes
+	size int64
+	// Cached tracks
+	entries map[cacheKey]*cacheEntry
+	// Least recently used tracks are at the back of the list
+	lru *list.List
+	// The downloads which are in progress
+	pending map[cacheKey]*pendingDownload
+	// The quality which was actually downloaded when a track was not available in requested quality
+	fallbacks map[cacheKey]Quality
+	mu        sync.Mutex
+}
+
+// NewCachedDownloader creates a CachedDownloader which stores the tracks in directory
+// The files which already exist in directory are added to the cache
+func NewCachedDownloader(downloader Downloader, directory string, maxSize int64) (*CachedDownloader, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	c := &CachedDownloader{
+		downloader: downloader,
+		directory:  directory,
+		maxSize:    maxSize,
+		entries:    make(map[cacheKey]*cacheEntry),
+		lru:        list.New(),
+		pending:    make(map[cacheKey]*pendingDownload),
+		fallbacks:  make(map[cacheKey]Quality),
+	}
+	err = c.recover()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// recover indexes the files which exist in the cache directory
+// The modification time of files is used as their last usage time
+func (c *CachedDownloader) recover() error {
+	files, err := os.ReadDir(c.directory)
+	if err != nil {
+		return err
+	}
+	type recoveredFile struct {
+		entry   *cacheEntry
+		modTime time.Time
+	}
+	recovered := make([]recoveredFile, 0, len(files))
+	sidecars := make([]fs.DirEntry, 0)
+	for _, file := range files {
+		// Remove the files which were not written completely
+		if strings.HasPrefix(file.Name(), partialFilePrefix) {
+			_ = os.Remove(filepath.Join(c.directory, file.Name()))
+			continue
+		}
+		if !file.IsDir() && strings.Contains(file.Name(), sidecarSeparator) {
+			sidecars = append(sidecars, file)
+			continue
+		}
+		if file.IsDir() || !isAudioFile(file.Name()) {
+			continue
+		}
+		path := filepath.Join(c.directory, file.Name())
+		key, ok := parseCacheFileName(file.Name())
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		// Keep only one file for each key
+		if _, exists := c.entries[key]; exists {
+			_ = os.Remove(path)
+			continue
+		}
+		entry := &cacheEntry{key: key, path: path, size: info.Size()}
+		c.entries[key] = entry
+		recovered = append(recovered, recoveredFile{entry: entry, modTime: info.ModTime()})
+	}
+	// Add the sidecars to their audio files. Sidecars without audio file are removed
+	for _, file := range sidecars {
+		path := filepath.Join(c.directory, file.Name())
+		key, ok := parseCacheFileName(file.Name())
+		entry, exists := c.entries[key]
+		info, err := file.Info()
+		if !ok || !exists || err != nil {
+			_ = os.Remove(path)
+			continue
+		}
+		entry.sidecars = append(entry.sidecars, path)
+		entry.size += info.Size()
+	}
+	// Most recently used files go to front
+	sort.Slice(recovered, func(i, j int) bool {
+		return recovered[i].modTime.After(recovered[j].modTime)
+	})
+	for _, file := range recovered {
+		file.entry.element = c.lru.PushBack(file.entry)
+		c.size += file.entry.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	log.Printf("Indexed %d cached tracks (%d MB)\n", len(c.entries), c.size/1024/1024)
+	return nil
+}
+
+// Download returns the track from cache or downloads it and adds it to cache
+func (c *CachedDownloader) Download(ctx context.Context, track Track, quality Quality) (*Audio, error) {
+	id, ok := trackID(track)
+	if !ok { // We can't cache the tracks without ID
+		return c.downloader.Download(ctx, track, quality)
+	}
+	key := cacheKey{trackID: id, quality: quality}
+	var pending *pendingDownload
+	for {
+		c.mu.Lock()
+		// Check the cache
+		if audio := c.get(key); audio != nil {
+			c.mu.Unlock()
+			return audio, nil
+		}
+		// Wait if someone else is downloading this track
+		var downloading bool
+		pending, downloading = c.pending[key]
+		if !downloading {
+			pending = &pendingDownload{done: make(chan struct{})}
+			c.pending[key] = pending
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-pending.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	// Download the track
+	audio, err := c.downloader.Download(ctx, track, quality)
+	if err == nil && audio.Downloading() {
+		// Let the caller play the file and add it to cache after it's downloaded
+		c.addWhenDownloaded(key, audio, pending)
+		return audio, nil
+	}
+	if err == nil {
+		audio = c.add(key, audio)
+	}
+	c.finishPending(key, pending)
+	return audio, err
+}
+
+// finishPending removes a pending download and wakes up the downloads which are waiting for it
+func (c *CachedDownloader) finishPending(key cacheKey, pending *pendingDownload) {
+	c.mu.Lock()
+	delete(c.pending, key)
+	close(pending.done)
+	c.mu.Unlock()
+}
+
+// addWhenDownloaded copies an audio which is still being downloaded to cache after its download is finished
+// The temporary file of audio is kept until both the caller and the cache release it
+func (c *CachedDownloader) addWhenDownloaded(key cacheKey, audio *Audio, pending *pendingDownload) {
+	var users sync.WaitGroup
+	users.Add(2)
+	cleanup := audio.cleanup
+	var once sync.Once
+	audio.cleanup = func() {
+		once.Do(users.Done)
+	}
+	go func() {
+		users.Wait()
+		if cleanup != nil {
+			cleanup()
+		}
+	}()
+	go func() {
+		defer users.Done()
+		defer c.finishPending(key, pending)
+		if audio.Wait() != nil { // Don't cache the partial files
+			return
+		}
+		// The file is copied because the caller might still be reading it
+		c.add(key, &Audio{Path: audio.Path, Quality: audio.Quality}).Close()
+	}()
+}
+
+// get gets the audio of a key from cache and marks it as used
+// nil is returned if the key is not cached
+// c.mu must be locked when calling this function
+func (c *CachedDownloader) get(key cacheKey) *Audio {
+	if fallback, exists := c.fallbacks[key]; exists {
+		key.quality = fallback
+	}
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil
+	}
+	c.lru.MoveToFront(entry.element)
+	now := time.Now()
+	_ = os.Chtimes(entry.path, now, now)
+	return c.use(entry)
+}
+
+// use creates an Audio from an entry which prevents its eviction until it's closed
+// c.mu must be locked when calling this function
+func (c *CachedDownloader) use(entry *cacheEntry) *Audio {
+	entry.users++
+	var once sync.Once
+	return &Audio{
+		Path:          entry.path,
+		Quality:       entry.key.quality,
+		sidecarPrefix: filepath.Join(c.directory, entry.key.sidecarPrefix()),
+		addSidecar: func(path string) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for _, sidecar := range entry.sidecars {
+				if sidecar == path { // Already added
+					return
+				}
+			}
+			entry.sidecars = append(entry.sidecars, path)
+			entry.size += info.Size()
+			c.size += info.Size()
+			c.evict()
+		},
+		cleanup: func() {
+			once.Do(func() {
+				c.mu.Lock()
+				entry.users--
+				c.evict()
+				c.mu.Unlock()
+			})
+		},
+	}
+}
+
+// add moves a downloaded audio to the cache directory and returns the cached audio
+// If the audio cannot be cached, it's returned as is
+func (c *CachedDownloader) add(requestedKey cacheKey, audio *Audio) *Audio {
+	key := requestedKey
+	if audio.Quality != "" {
+		key.quality = audio.Quality
+	}
+	// The track might be cached in the lower quality before
+	c.mu.Lock()
+	if key != requestedKey {
+		c.fallbacks[requestedKey] = key.quality
+	}
+	if cached := c.get(key); cached != nil {
+		c.mu.Unlock()
+		audio.Close()
+		return cached
+	}
+	c.mu.Unlock()
+	// Move the file to cache
+	path := filepath.Join(c.directory, key.fileName(filepath.Ext(audio.Path)))
+	var err error
+	if audio.temporary {
+		err = moveFile(audio.Path, path)
+	} else {
+		err = copyFile(audio.Path, path)
+	}
+	if err != nil {
+		log.Println("cannot add the track to cache:", err)
+		return audio
+	}
+	audio.Close()
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	// Index the file
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, exists := c.entries[key]
+	if !exists {
+		entry = &cacheEntry{key: key, path: path, size: size}
+		entry.element = c.lru.PushFront(entry)
+		c.entries[key] = entry
+		c.size += entry.size
+	}
+	result := c.use(entry)
+	c.evict()
+	return result
+}
+
+// evict removes the least recently used tracks which are not in use until the cache fits in its size
+// c.mu must be locked when calling this function
+func (c *CachedDownloader) evict() {
+	for element := c.lru.Back(); element != nil && c.size > c.maxSize; {
+		entry := element.Value.(*cacheEntry)
+		element = element.Prev()
+		if entry.users > 0 {
+			continue
+		}
+		c.lru.Remove(entry.element)
+		delete(c.entries, entry.key)
+		for requested, fallback := range c.fallbacks {
+			if requested.trackID == entry.key.trackID && fallback == entry.key.quality {
+				delete(c.fallbacks, requested)
+			}
+		}
+		c.size -= entry.size
+		_ = os.Remove(entry.path)
+		for _, sidecar := range entry.sidecars {
+			_ = os.Remove(sidecar)
+		}
+	}
+}
+
+// moveFile moves a file. If the file cannot be renamed (like when moving between disks), it's copied
+func moveFile(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile copies a file to another path
+// The destination is written in a temporary file at first to never leave partial files
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(dst), PartialFilePattern)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
@@ -0,0 +1,249 @@
+package deezer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCache creates a CachedDownloader which gets the tracks 1 to count from a local directory
+// Each track is 100 bytes
+func newTestCache(t *testing.T, count int, maxSize int64) (*CachedDownloader, string) {
+	source := t.TempDir()
+	for i := 1; i <= count; i++ {
+		writeTestFile(t, source, strconv.Itoa(i)+".mp3", 100)
+	}
+	directory := t.TempDir()
+	cache, err := NewCachedDownloader(LocalDownloader{Directory: source}, directory, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache, directory
+}
+
+// downloadTest downloads a track from a downloader in 128 quality and fails the test on errors
+func downloadTest(t *testing.T, downloader Downloader, id int) *Audio {
+	audio, err := downloader.Download(context.Background(), Track{ID: id}, Quality128)
+	if err != nil {
+		t.Fatalf("cannot download %d: %s", id, err)
+	}
+	return audio
+}
+
+func TestCachedDownloaderEvictionOrder(t *testing.T) {
+	cache, directory := newTestCache(t, 3, 250)
+	downloadTest(t, cache, 1).Close()
+	downloadTest(t, cache, 2).Close()
+	// Use 1 again, so 2 is the least recently used track
+	audio := downloadTest(t, cache, 1)
+	if filepath.Dir(audio.Path) != directory {
+		t.Fatalf("expected the audio from cache, got %s", audio.Path)
+	}
+	audio.Close()
+	downloadTest(t, cache, 3).Close()
+	if !fileExists(filepath.Join(directory, "1-128.mp3")) || !fileExists(filepath.Join(directory, "3-128.mp3")) {
+		t.Fatal("recently used tracks are evicted")
+	}
+	if fileExists(filepath.Join(directory, "2-128.mp3")) {
+		t.Fatal("least recently used track is not evicted")
+	}
+	if cache.size != 200 {
+		t.Fatalf("expected cache size 200, got %d", cache.size)
+	}
+}
+
+func TestCachedDownloaderInUse(t *testing.T) {
+	cache, directory := newTestCache(t, 2, 150)
+	first := downloadTest(t, cache, 1)
+	second := downloadTest(t, cache, 2)
+	// Both are in use, so the cache can be bigger than its limit
+	if !fileExists(first.Path) || !fileExists(second.Path) {
+		t.Fatal("a track which is in use is evicted")
+	}
+	if cache.size != 200 {
+		t.Fatalf("expected cache size 200, got %d", cache.size)
+	}
+	// The first one is evicted as soon as it's released
+	first.Close()
+	if fileExists(filepath.Join(directory, "1-128.mp3")) {
+		t.Fatal("released track is not evicted")
+	}
+	// Closing twice must not release the entry twice
+	second.Close()
+	second.Close()
+	if cache.entries[cacheKey{trackID: 2, quality: Quality128}].users != 0 {
+		t.Fatal("unexpected users of entry")
+	}
+	if !fileExists(filepath.Join(directory, "2-128.mp3")) {
+		t.Fatal("track which fits in cache is evicted")
+	}
+}
+
+func TestCachedDownloaderSidecars(t *testing.T) {
+	cache, directory := newTestCache(t, 2, 250)
+	audio := downloadTest(t, cache, 1)
+	sidecar, ok := audio.SidecarPath("opus")
+	if !ok {
+		t.Fatal("cached audio does not support sidecars")
+	}
+	if filepath.Dir(sidecar) != directory {
+		t.Fatalf("sidecar is not in cache directory: %s", sidecar)
+	}
+	writeTestFile(t, directory, filepath.Base(sidecar), 100)
+	audio.AddSidecar(sidecar)
+	audio.AddSidecar(sidecar)
+	audio.Close()
+	if cache.size != 200 {
+		t.Fatalf("expected cache size 200 with sidecar, got %d", cache.size)
+	}
+	// The sidecar is evicted with its track
+	downloadTest(t, cache, 2).Close()
+	if fileExists(sidecar) || fileExists(filepath.Join(directory, "1-128.mp3")) {
+		t.Fatal("track and its sidecar are not evicted")
+	}
+	if cache.size != 100 {
+		t.Fatalf("expected cache size 100, got %d", cache.size)
+	}
+}
+
+func TestCachedDownloaderRecover(t *testing.T) {
+	directory := t.TempDir()
+	old := writeTestFile(t, directory, "1-128.mp3", 100)
+	oldSidecar := writeTestFile(t, directory, "1-128.sidecar.opus", 50)
+	recent := writeTestFile(t, directory, "2-320.mp3", 100)
+	partial := writeTestFile(t, directory, partialFilePrefix+"123", 100)
+	orphanSidecar := writeTestFile(t, directory, "5-128.sidecar.opus", 100)
+	unknown := writeTestFile(t, directory, "unknown.mp3", 100)
+	oldTime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+	// Everything fits in cache
+	cache, err := NewCachedDownloader(LocalDownloader{Directory: t.TempDir()}, directory, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(partial) || fileExists(orphanSidecar) {
+		t.Fatal("partial files and orphan sidecars are not removed")
+	}
+	if !fileExists(unknown) {
+		t.Fatal("unknown files must not be touched")
+	}
+	if len(cache.entries) != 2 || cache.size != 250 {
+		t.Fatalf("expected 2 entries with size 250, got %d entries with size %d", len(cache.entries), cache.size)
+	}
+	// The oldest file is evicted when the cache is smaller
+	cache, err = NewCachedDownloader(LocalDownloader{Directory: t.TempDir()}, directory, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(old) || fileExists(oldSidecar) || !fileExists(recent) {
+		t.Fatal("the least recently used track is not evicted on recovery")
+	}
+	if cache.size != 100 {
+		t.Fatalf("expected cache size 100, got %d", cache.size)
+	}
+}
+
+// blockingDownloader is a Downloader which waits for a channel before returning a copy of a file
+type blockingDownloader struct {
+	source  string
+	release chan struct{}
+	calls   int
+	mu      sync.Mutex
+}
+
+func (d *blockingDownloader) Download(ctx context.Context, _ Track, quality Quality) (*Audio, error) {
+	d.mu.Lock()
+	d.calls++
+	d.mu.Unlock()
+	select {
+	case <-d.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &Audio{Path: d.source, Quality: quality}, nil
+}
+
+func (d *blockingDownloader) callCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls
+}
+
+func TestCachedDownloaderConcurrentDownloads(t *testing.T) {
+	downloader := &blockingDownloader{
+		source:  writeTestFile(t, t.TempDir(), "1.mp3", 100),
+		release: make(chan struct{}),
+	}
+	directory := t.TempDir()
+	cache, err := NewCachedDownloader(downloader, directory, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const downloads = 5
+	audios := make([]*Audio, downloads)
+	errs := make([]error, downloads)
+	var wg sync.WaitGroup
+	for i := 0; i < downloads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			audios[i], errs[i] = cache.Download(context.Background(), Track{ID: 1}, Quality128)
+		}(i)
+	}
+	// Wait until one of them starts the download, then let the others queue behind it
+	for downloader.callCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(downloader.release)
+	wg.Wait()
+	if calls := downloader.callCount(); calls != 1 {
+		t.Fatalf("expected one download, got %d", calls)
+	}
+	expected := filepath.Join(directory, "1-128.mp3")
+	for i := range audios {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if audios[i].Path != expected {
+			t.Fatalf("expected %s, got %s", expected, audios[i].Path)
+		}
+		audios[i].Close()
+	}
+	if cache.entries[cacheKey{trackID: 1, quality: Quality128}].users != 0 {
+		t.Fatal("entry is still in use after all audios are closed")
+	}
+}
+
+func TestCachedDownloaderCancelWhileWaiting(t *testing.T) {
+	downloader := &blockingDownloader{
+		source:  writeTestFile(t, t.TempDir(), "1.mp3", 100),
+		release: make(chan struct{}),
+	}
+	cache, err := NewCachedDownloader(downloader, t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		audio, err := cache.Download(context.Background(), Track{ID: 1}, Quality128)
+		if err == nil {
+			audio.Close()
+		}
+	}()
+	for downloader.callCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// The second download waits for the first one and gives up when it's cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = cache.Download(ctx, Track{ID: 1}, Quality128); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	close(downloader.release)
+}
@@ -0,0 +1,58 @@
+package deezer
+
+import (
+	"errors"
+	"strings"
+)
+
+// InvalidArlError is returned when deemix cannot log in to deezer because the ARL is invalid or expired
+var InvalidArlError = errors.New("the deezer ARL is invalid or expired")
+
+// RegionUnavailableError is returned when a track is not available in the country of deezer account
+var RegionUnavailableError = errors.New("the track is not available in this region")
+
+// QualityUnavailableError is returned when the deezer account cannot download a track in the requested quality
+var QualityUnavailableError = errors.New("the track is not available in this quality")
+
+// NetworkError is returned when deemix cannot connect to deezer
+var NetworkError = errors.New("cannot connect to deezer")
+
+// DownloadTimeoutError is returned when deemix does not finish the download in time
+var DownloadTimeoutError = errors.New("the download timed out")
+
+// deemixErrorMessages maps the messages which deemix prints to errors
+// The messages are lower case
+var deemixErrorMessages = []struct {
+	message string
+	err     error
+}{
+	// deemix asks for the ARL when it cannot log in
+	{"paste here your arl", InvalidArlError},
+	{"invalid arl", InvalidArlError},
+	{"from your current country", RegionUnavailableError},
+	{"wronggeolocation", RegionUnavailableError},
+	{"at the desired bitrate", QualityUnavailableError},
+	{"wronglicense", QualityUnavailableError},
+	{"not found at desired bitrate", QualityUnavailableError},
+	{"preferredbitratenotfound", QualityUnavailableError},
+	{"track not available on deezer", MusicNotFoundError},
+	{"not yet encoded", MusicNotFoundError},
+	{"connectionerror", NetworkError},
+	{"max retries exceeded", NetworkError},
+	{"temporary failure in name resolution", NetworkError},
+	{"connection refused", NetworkError},
+	{"connection reset", NetworkError},
+	{"timed out", NetworkError},
+}
+
+// classifyDeemixOutput finds the error which deemix has reported in its output
+// nil is returned if the output does not contain a known error
+func classifyDeemixOutput(output string) error {
+	output = strings.ToLower(output)
+	for _, known := range deemixErrorMessages {
+		if strings.Contains(output, known.message) {
+			return known.err
+		}
+	}
+	return nil
+}
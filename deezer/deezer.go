@@ -1,164 +1,343 @@
 package deezer
 
 import (
-	"bytes"
+	"Deemix-Discord-Bot/spotify"
 	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os/exec"
-	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// httpClient is the client to do the requests with it
-var httpClient = &http.Client{
-	Timeout: 5 * time.Second,
-	CheckRedirect: func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
-	},
+// Client is a client for deezer API
+// The zero value is not usable. Use NewClient to create it and change its fields before using it.
+type Client struct {
+	// The base url of deezer API
+	APIURL string
+	// The url of deezer's website gateway. Used to check the ARLs
+	GatewayURL string
+	// The client to do the requests with it. It must not follow the redirects because the short links
+	// are followed manually
+	HTTPClient *http.Client
+	// The user agent which is sent in requests. The default user agent of Go is used if it's empty
+	UserAgent string
+	// The maximum number of results of a search
+	MaxSearchEntries int
+	// The number of tracks which we request in each page of a playlist
+	PlaylistPageSize int
+	// The maximum number of redirects which we follow for short links
+	MaxShortLinkRedirects int
+	// The number of times which a request is retried when the quota of API is exceeded
+	QuotaRetries int
+	// The delay before retrying a request for the first time when the quota is exceeded
+	// It's doubled for each retry
+	QuotaBackoff time.Duration
+	// The time which the results of SearchTrack and GetTrack are cached
+	CacheTTL time.Duration
+	// The maximum number of cached results. Zero disables the cache
+	CacheSize int
+	// The number of spotify tracks which are matched with deezer tracks at once
+	// Each match might need up to three requests and deezer allows about 50 requests in 5 seconds
+	SpotifyMatchWorkers int
+	// Spotify is used to resolve the spotify links
+	// If it's nil, spotify links are not supported
+	Spotify *spotify.Client
+	// The cached results of SearchTrack and GetTrack
+	cache *responseCache
 }
 
-// trackPathRegex is used to extract the track ID from path of deezer
-var trackPathRegex = regexp.MustCompile("/track/(\\d+)")
+// NewClient creates a new deezer client which uses the deezer servers
+func NewClient() *Client {
+	return &Client{
+		APIURL:     "https://api.deezer.com",
+		GatewayURL: "https://www.deezer.com/ajax/gw-light.php",
+		HTTPClient: &http.Client{
+			Timeout: 5 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxSearchEntries:      5,
+		PlaylistPageSize:      100,
+		MaxShortLinkRedirects: 5,
+		QuotaRetries:          3,
+		QuotaBackoff:          time.Second,
+		CacheTTL:              10 * time.Minute,
+		CacheSize:             1000,
+		SpotifyMatchWorkers:   4,
+		cache:                 newResponseCache(),
+	}
+}
+
+// cached gets a result from the cache of client
+func (c *Client) cached(key string) (interface{}, bool) {
+	if c.CacheSize <= 0 {
+		return nil, false
+	}
+	return c.cache.get(key)
+}
 
-// trackSearchEndpoint is where we should send our search requests for tracks
-const trackSearchEndpoint = "https://api.deezer.com/search"
+// store puts a result in the cache of client
+func (c *Client) store(key string, value interface{}) {
+	if c.CacheSize > 0 {
+		c.cache.put(key, value, c.CacheTTL, c.CacheSize)
+	}
+}
 
-// maxSearchEntries is the maximum number of searches in response
-const maxSearchEntries = 5
+// CacheStats returns the number of requests which are answered from cache (hits) and
+// the ones which are sent to deezer (misses)
+func (c *Client) CacheStats() (hits, misses uint64) {
+	return c.cache.stats()
+}
 
-// SearchTrack searches the deezer for a track by keyword
-func SearchTrack(keyword string) ([]SearchedTrack, error) {
-	// Build the request and do it
-	req, err := http.NewRequest("GET", trackSearchEndpoint, nil)
+// do sends a request with the user agent of client
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// get sends a GET request to the API and decodes the result in "result"
+// "endpoint" can be either a path in the API or a full url (like the next page urls)
+// The error payloads of deezer are converted to errors. If the quota is exceeded, the request is retried later.
+func (c *Client) get(endpoint string, result interface{}) error {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = c.APIURL + endpoint
+	}
+	delay := c.QuotaBackoff
+	for retry := 0; ; retry++ {
+		err := c.getOnce(endpoint, result)
+		if err != QuotaExceededError || retry >= c.QuotaRetries {
+			return err
+		}
+		log.Printf("Deezer quota exceeded, retrying %s in %s\n", endpoint, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// getOnce sends a GET request to an url and decodes the result in "result"
+func (c *Client) getOnce(endpoint string, result interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	q := req.URL.Query()
-	q.Set("q", keyword)
-	req.URL.RawQuery = q.Encode()
-	// Send the request
-	resp, err := httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var respRaw trackSearchResponse
-	err = json.NewDecoder(resp.Body).Decode(&respRaw)
+	body, err := io.ReadAll(resp.Body)
 	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return QuotaExceededError
+	}
+	// Deezer sends the errors with status 200
+	var errorPayload errorResponse
+	if json.Unmarshal(body, &errorPayload) == nil {
+		if err = errorPayload.err(); err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("deezer error: status " + strconv.Itoa(resp.StatusCode))
+	}
+	return json.Unmarshal(body, result)
+}
+
+// SearchTrack searches the deezer for a track by keyword
+// The results are cached. The keywords which only differ in case and whitespaces have the same results
+func (c *Client) SearchTrack(keyword string) ([]SearchedTrack, error) {
+	if result, ok := c.CachedSearchTrack(keyword); ok {
+		return result, nil
+	}
+	keyword = normalizeQuery(keyword)
+	var respRaw trackSearchResponse
+	err := c.get("/search?q="+url.QueryEscape(keyword), &respRaw)
 	if err != nil {
 		return nil, err
 	}
 	// Convert the raw response to SearchResult array
-	result := make([]SearchedTrack, 0, maxSearchEntries)
-	for i, entry := range respRaw.Data {
-		if i >= maxSearchEntries { // limit entries of result
+	result := make([]SearchedTrack, 0, c.MaxSearchEntries)
+	for _, entry := range respRaw.Data {
+		if len(result) >= c.MaxSearchEntries { // limit entries of result
 			break
 		}
+		if entry.Link == "" {
+			continue
+		}
 		result = append(result, entry.SearchedTrack())
 	}
+	c.store("search:"+keyword, append([]SearchedTrack(nil), result...))
 	return result, nil
 }
 
+// CachedSearchTrack gets the results of SearchTrack without sending any requests
+// ok is false if the results of keyword are not cached
+func (c *Client) CachedSearchTrack(keyword string) (result []SearchedTrack, ok bool) {
+	cached, ok := c.cached("search:" + normalizeQuery(keyword))
+	if !ok {
+		return nil, false
+	}
+	// Copy it to let the caller change the result
+	return append([]SearchedTrack(nil), cached.([]SearchedTrack)...), true
+}
+
 // GetTrack gets a single track's info by its track ID
-func GetTrack(trackID int) (Track, error) {
-	resp, err := httpClient.Get("https://api.deezer.com/track/" + strconv.Itoa(trackID))
+// The tracks are cached
+func (c *Client) GetTrack(trackID int) (Track, error) {
+	cacheKey := "track:" + strconv.Itoa(trackID)
+	if cached, ok := c.cached(cacheKey); ok {
+		return cached.(Track), nil
+	}
+	var result trackInfoResponse
+	err := c.get("/track/"+strconv.Itoa(trackID), &result)
 	if err != nil {
 		return Track{}, err
 	}
-	var result trackInfoResponse
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	_ = resp.Body.Close()
-	return result.Track(), err
+	if result.Link == "" {
+		return Track{}, EmptyTrackError
+	}
+	track := result.Track()
+	c.store(cacheKey, track)
+	return track, nil
 }
 
-// KeywordToLink at firsts checks if the text is a link or not
-// If it's a link, it will return the text itself
-// Otherwise it searches deezer for the text and returns the first result's Track
-func KeywordToLink(text string) (track Track, err error) {
-	// If the text is url just return it
-	u, err := url.Parse(text)
-	if err == nil && u.Scheme != "" && u.Host != "" {
-		return trackFromUrl(u)
+// GetAlbum gets the title and the tracklist of an album by its album ID
+func (c *Client) GetAlbum(albumID int) (TrackList, error) {
+	var result albumInfoResponse
+	err := c.get("/album/"+strconv.Itoa(albumID), &result)
+	if err != nil {
+		return TrackList{}, err
 	}
-	// Otherwise, search deezer
-	tracks, _ := SearchTrack(text)
-	if len(tracks) == 0 {
-		return Track{}, errors.New("track not found")
+	tracks := result.TrackList()
+	if len(tracks.Tracks) == 0 {
+		return TrackList{}, errors.New("album is empty")
 	}
-	return tracks[0].Track, nil
+	return tracks, nil
 }
 
-// trackFromUrl tries to get a Track from url
-func trackFromUrl(u *url.URL) (track Track, err error) {
-	if u.Host == "deezer.page.link" {
-		// This is a readwrite page. Just open it and follow the redirection
-		resp, err := httpClient.Head(u.String())
+// GetPlaylist gets the title and the tracklist of a playlist by its playlist ID
+// At most maxTracks tracks are fetched from the playlist
+func (c *Client) GetPlaylist(playlistID, maxTracks int) (TrackList, error) {
+	// Get the title of playlist
+	var info playlistInfoResponse
+	err := c.get("/playlist/"+strconv.Itoa(playlistID), &info)
+	if err != nil {
+		return TrackList{}, err
+	}
+	result := TrackList{Name: info.Title}
+	// Get the tracks page by page
+	next := "/playlist/" + strconv.Itoa(playlistID) + "/tracks?limit=" + strconv.Itoa(c.PlaylistPageSize)
+	for next != "" && len(result.Tracks) < maxTracks {
+		var page playlistTracksResponse
+		err = c.get(next, &page)
 		if err != nil {
-			log.Println("cannot head the page with url", u.String(), ":", err)
-			return Track{}, errors.New("cannot load page data")
+			return TrackList{}, err
 		}
-		_ = resp.Body.Close()
-		u, err = url.Parse(resp.Header.Get("location"))
-		if err != nil {
-			return Track{}, errors.New("cannot parse the url after redirect")
+		for _, track := range page.Data {
+			if len(result.Tracks) >= maxTracks {
+				break
+			}
+			if track.Link == "" {
+				result.Missing++
+				continue
+			}
+			result.Tracks = append(result.Tracks, track.Track())
 		}
+		// Empty pages mean that we are done. This prevents infinite loops on bad responses
+		if len(page.Data) == 0 {
+			break
+		}
+		next = page.Next
 	}
-	if u.Host != "www.deezer.com" {
-		return Track{}, errors.New("invalid url")
+	if len(result.Tracks) == 0 {
+		return TrackList{}, errors.New("playlist is empty")
 	}
-	// Extract the track ID
-	matches := trackPathRegex.FindStringSubmatch(u.Path)
-	// Check if the url is a track link
-	if len(matches) != 2 {
-		return Track{}, errors.New("invalid url")
+	return result, nil
+}
+
+// GetArtistTopTracks gets the top tracks of an artist by its artist ID
+func (c *Client) GetArtistTopTracks(artistID, count int) (TrackList, error) {
+	// Get the name of artist
+	var info artistInfoResponse
+	err := c.get("/artist/"+strconv.Itoa(artistID), &info)
+	if err != nil {
+		return TrackList{}, err
 	}
-	trackID, err := strconv.Atoi(matches[1])
+	// Get the top tracks
+	var top trackSearchResponse
+	err = c.get("/artist/"+strconv.Itoa(artistID)+"/top?limit="+strconv.Itoa(count), &top)
 	if err != nil {
-		return Track{}, errors.New("invalid url")
+		return TrackList{}, err
+	}
+	result := TrackList{
+		Name:   info.Name + " top tracks",
+		Tracks: make([]Track, 0, count),
+	}
+	for _, track := range top.Data {
+		if len(result.Tracks) >= count {
+			break
+		}
+		if track.Link == "" {
+			continue
+		}
+		result.Tracks = append(result.Tracks, track.Track())
+	}
+	if len(result.Tracks) == 0 {
+		return TrackList{}, errors.New("artist has no tracks")
 	}
-	// Now get the track from track ID
-	return GetTrack(trackID)
+	return result, nil
 }
 
-// Download tries to download a spotify/deezer track from deezer
-// We return a pointer to ensure that user don't recklessly call TempDir.Delete on result
-func Download(u string, stopChannel <-chan struct{}) (*TempDir, error) {
-	// Create a temp dir
-	dirName, err := ioutil.TempDir("", "deemix*")
-	if err != nil {
-		return nil, err
+// KeywordToTracks at firsts checks if the text is a link or not
+// If it's a link, it will return the track or the tracks of album/playlist/artist which the link points to
+// Spotify links are also converted to deezer tracks
+// Otherwise it searches deezer for the text and returns the first result's Track
+func (c *Client) KeywordToTracks(text string, options LinkOptions) (TrackList, error) {
+	// If the text is url just return it
+	u, err := url.Parse(text)
+	if err == nil && u.Scheme != "" && u.Host != "" {
+		if spotify.IsSpotifyUrl(u) {
+			return c.tracksFromSpotify(u, options)
+		}
+		return c.tracksFromUrl(u, options)
 	}
-	result := &TempDir{Address: dirName}
-	// Download the file
-	cmd := exec.Command("deemix", "-p", dirName, "-b", "128", u)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	err = cmd.Start()
+	// Otherwise, search deezer
+	tracks, _ := c.SearchTrack(text)
+	if len(tracks) == 0 {
+		return TrackList{}, errors.New("track not found")
+	}
+	return TrackList{Tracks: []Track{tracks[0].Track}}, nil
+}
+
+// tracksFromUrl tries to get a TrackList from url
+func (c *Client) tracksFromUrl(u *url.URL, options LinkOptions) (TrackList, error) {
+	resource, err := c.ResolveUrl(u)
 	if err != nil {
-		log.Printf("Error on excuting deemix: %s\n", stderr.String())
-		result.Delete()
-		return nil, err
+		return TrackList{}, err
 	}
-	// Wait either for the deemix to finish or kill it
-	doneChannel := make(chan struct{}, 1)
-	go func() {
-		select {
-		case <-doneChannel:
-		case <-stopChannel:
-			_ = cmd.Process.Kill()
+	switch resource.Type {
+	case ResourceTrack:
+		track, err := c.GetTrack(resource.ID)
+		if err != nil {
+			return TrackList{}, err
 		}
-	}()
-	err = cmd.Wait()
-	doneChannel <- struct{}{} // Don't wait for cancel anymore
-	if err != nil {
-		log.Printf("Error on excuting deemix: %s\n", stderr.String())
-		result.Delete()
-		return nil, err
+		return TrackList{Tracks: []Track{track}}, nil
+	case ResourceAlbum:
+		return c.GetAlbum(resource.ID)
+	case ResourcePlaylist:
+		return c.GetPlaylist(resource.ID, options.MaxPlaylistTracks)
+	case ResourceArtist:
+		return c.GetArtistTopTracks(resource.ID, options.ArtistTopTracks)
+	default:
+		return TrackList{}, errors.New("playing " + resource.Type.String() + " links is not supported")
 	}
-	// Return the directory
-	return result, nil
 }
@@ -0,0 +1,189 @@
+package deezer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSearchTrackLimitsResults(t *testing.T) {
+	var query string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query().Get("q")
+		tracks := make([]trackInfoResponse, 0, 10)
+		for i := 1; i <= 10; i++ {
+			track := fakeTrack(i, "track"+strconv.Itoa(i))
+			// Deezer sometimes returns the tracks which are not available anymore without link
+			if i == 2 || i == 4 {
+				track.Link = ""
+			}
+			tracks = append(tracks, track)
+		}
+		_ = json.NewEncoder(w).Encode(trackSearchResponse{Data: tracks})
+	}))
+	client.MaxSearchEntries = 3
+	tracks, err := client.SearchTrack("  Daft   PUNK ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "daft punk" {
+		t.Fatalf("expected normalized query, got %q", query)
+	}
+	if len(tracks) != 3 {
+		t.Fatalf("expected 3 tracks, got %d", len(tracks))
+	}
+	for i, id := range []int{1, 3, 5} {
+		if tracks[i].ID != id || tracks[i].Link == "" {
+			t.Fatalf("expected track %d at %d, got %+v", id, i, tracks[i])
+		}
+	}
+}
+
+func TestSearchTrackCache(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_ = json.NewEncoder(w).Encode(trackSearchResponse{Data: []trackInfoResponse{fakeTrack(1, "one")}})
+	}))
+	client.CacheSize = 10
+	for _, query := range []string{"one", "ONE", " one "} {
+		if _, err := client.SearchTrack(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("expected one request, got %d", requests)
+	}
+	if _, ok := client.CachedSearchTrack("One"); !ok {
+		t.Fatal("search is not cached")
+	}
+}
+
+func TestGetTrack(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/track/1":
+			track := fakeTrack(1, "one")
+			track.Duration = 185
+			track.Album.Title = "Album"
+			_ = json.NewEncoder(w).Encode(track)
+		case "/track/2":
+			// Deezer returns an empty object for some of the removed tracks
+			_, _ = w.Write([]byte(`{"id":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	track, err := client.GetTrack(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != 1 || track.Album != "Album" || track.FormatDuration() != "3:05" {
+		t.Fatalf("unexpected track %+v", track)
+	}
+	if _, err = client.GetTrack(2); err != EmptyTrackError {
+		t.Fatalf("expected EmptyTrackError, got %v", err)
+	}
+}
+
+func TestResolveShortLink(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "HEAD" {
+			t.Errorf("expected HEAD request, got %s", r.Method)
+		}
+		switch r.Header.Get("X-Original-Host") + r.URL.Path {
+		case "deezer.page.link/abc":
+			// Short links might redirect to other short links
+			w.Header().Set("Location", "https://link.deezer.com/s/def")
+			w.WriteHeader(http.StatusFound)
+		case "link.deezer.com/s/def":
+			w.Header().Set("Location", "https://www.deezer.com/en/album/302127?utm_source=deezer")
+			w.WriteHeader(http.StatusMovedPermanently)
+		case "deezer.page.link/loop":
+			w.Header().Set("Location", "/loop")
+			w.WriteHeader(http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	u, _ := url.Parse("https://deezer.page.link/abc")
+	resource, err := client.ResolveUrl(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resource != (Resource{Type: ResourceAlbum, ID: 302127}) {
+		t.Fatalf("unexpected resource %+v", resource)
+	}
+	// The redirects are limited
+	u, _ = url.Parse("https://deezer.page.link/loop")
+	if _, err = client.ResolveUrl(u); err != InvalidUrlError {
+		t.Fatalf("expected InvalidUrlError for a redirect loop, got %v", err)
+	}
+}
+
+func TestErrorPayloads(t *testing.T) {
+	tests := []struct {
+		payload string
+		err     error
+	}{
+		{`{"error":{"type":"Exception","message":"Quota limit exceeded","code":4}}`, QuotaExceededError},
+		{`{"error":{"type":"Exception","message":"Service busy","code":700}}`, ServiceBusyError},
+		{`{"error":{"type":"DataException","message":"no data","code":800}}`, DataNotFoundError},
+	}
+	for _, test := range tests {
+		var requests int32
+		payload := test.payload
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			// Deezer sends the errors with status 200
+			_, _ = w.Write([]byte(payload))
+		}))
+		client.QuotaRetries = 2
+		_, err := client.GetTrack(1)
+		if err != test.err {
+			t.Errorf("%s: expected %v, got %v", test.payload, test.err, err)
+		}
+		// Only the quota errors are retried
+		expectedRequests := int32(1)
+		if test.err == QuotaExceededError {
+			expectedRequests = 3
+		}
+		if requests != expectedRequests {
+			t.Errorf("%s: expected %d requests, got %d", test.payload, expectedRequests, requests)
+		}
+	}
+	// Other errors keep the details of deezer
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":{"type":"ParameterException","message":"Wrong parameter","code":501}}`))
+	}))
+	_, err := client.SearchTrack("x")
+	apiError, ok := err.(*APIError)
+	if !ok || apiError.Code != 501 || apiError.Message != "Wrong parameter" {
+		t.Fatalf("expected APIError 501, got %v", err)
+	}
+}
+
+func TestQuotaRecovers(t *testing.T) {
+	var requests int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(fakeTrack(1, "one"))
+	}))
+	track, err := client.GetTrack(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != 1 || requests != 2 {
+		t.Fatalf("expected track 1 after a retry, got %+v in %d requests", track, requests)
+	}
+}
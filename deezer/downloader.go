@@ -0,0 +1,280 @@
+package deezer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MusicNotFoundError is returned when the downloader does not produce any audio file
+var MusicNotFoundError = errors.New("music not found")
+
+// Downloader downloads the tracks to play them
+type Downloader interface {
+	// Download downloads a track in the given quality and returns the playable audio of it
+	// Lower qualities might be downloaded if the requested one is not available
+	// The audio might be returned before it's downloaded completely. See Audio.Open.
+	// The download must be stopped when ctx is cancelled
+	Download(ctx context.Context, track Track, quality Quality) (*Audio, error)
+}
+
+// Audio is an audio file which is ready to be played
+type Audio struct {
+	// The path of audio file
+	Path string
+	// The quality which the audio is downloaded in
+	Quality Quality
+	// If true, the file is temporary and can be moved by the user of audio
+	temporary bool
+	// The path prefix of sidecar files. Empty if the audio does not support sidecars
+	sidecarPrefix string
+	// addSidecar is called when a sidecar file is written
+	addSidecar func(path string)
+	// cleanup is called when the audio is not needed anymore
+	cleanup func()
+	// download is not nil if the file was still being written when the audio was returned
+	download *audioDownload
+}
+
+// Downloading checks if the audio file is still being written
+func (a *Audio) Downloading() bool {
+	return a.download != nil && !a.download.finished()
+}
+
+// Wait waits until the audio file is written completely and returns the error of download
+func (a *Audio) Wait() error {
+	if a.download == nil {
+		return nil
+	}
+	<-a.download.done
+	return a.download.err
+}
+
+// DownloadError returns the error which stopped the download of audio file in the middle
+// nil is returned if the download is successful or is not finished yet
+func (a *Audio) DownloadError() error {
+	if a.download == nil || !a.download.finished() {
+		return nil
+	}
+	return a.download.err
+}
+
+// Open opens the audio file for reading
+// If the file is still being written, the reader waits for the new data until the download is finished.
+func (a *Audio) Open() (io.ReadCloser, error) {
+	if a.download == nil {
+		return os.Open(a.Path)
+	}
+	return openGrowingFile(a.Path, a.download)
+}
+
+// SidecarPath returns the path of a file which can keep the data which is derived from this audio
+// like its encoded frames. The sidecar files live as long as the audio file itself.
+// ok is false if the audio is not persistent (like when it's not cached)
+func (a *Audio) SidecarPath(name string) (path string, ok bool) {
+	if a.sidecarPrefix == "" {
+		return "", false
+	}
+	return a.sidecarPrefix + name, true
+}
+
+// AddSidecar must be called after a sidecar file is written completely in the path which SidecarPath returned
+func (a *Audio) AddSidecar(path string) {
+	if a.addSidecar != nil {
+		a.addSidecar(path)
+	}
+}
+
+// Close releases the audio file. The file must not be used after calling this
+func (a *Audio) Close() {
+	if a.cleanup != nil {
+		a.cleanup()
+	}
+}
+
+// DownloaderOptions are the options of the downloaders which NewDownloader creates
+type DownloaderOptions struct {
+	// The directory of audio files which "local" downloader serves
+	LocalDirectory string
+	// The maximum time which deemix can take to start writing a playable audio. Zero means no timeout
+	Timeout time.Duration
+	// The config of deemix. deemix's own config is used if it's nil
+	DeemixConfig *DeemixConfig
+}
+
+// NewDownloader creates a Downloader by its name
+// "deemix" uses the deemix command and "local" serves the audio files in options.LocalDirectory
+func NewDownloader(name string, options DownloaderOptions) (Downloader, error) {
+	switch name {
+	case "", "deemix":
+		return DeemixDownloader{Timeout: options.Timeout, Config: options.DeemixConfig}, nil
+	case "local":
+		if options.LocalDirectory == "" {
+			return nil, errors.New("local downloader needs a directory")
+		}
+		return LocalDownloader{Directory: options.LocalDirectory}, nil
+	default:
+		return nil, errors.New("unknown downloader: " + name)
+	}
+}
+
+// DeemixDownloader downloads the tracks with deemix command
+type DeemixDownloader struct {
+	// The maximum time which deemix can take to start writing a playable audio. Zero means no timeout
+	// DownloadTimeoutError is returned if the process is killed because of it. The timeout is stopped when
+	// the audio is returned, so a slow download doesn't fail while it's being played.
+	Timeout time.Duration
+	// The config which deemix uses. deemix's own config is used if it's nil
+	Config *DeemixConfig
+}
+
+// Download tries to download a deezer track with deemix
+// If the track cannot be downloaded in the given quality, lower qualities are tried
+// The errors which deemix reports are converted to the errors of this package like InvalidArlError
+func (d DeemixDownloader) Download(ctx context.Context, track Track, quality Quality) (*Audio, error) {
+	for {
+		audio, err := d.download(ctx, track, quality)
+		if err == nil {
+			return audio, nil
+		}
+		// Don't try again if the download is cancelled
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Other qualities won't help with the other errors
+		if err != QualityUnavailableError && err != MusicNotFoundError {
+			return nil, err
+		}
+		lower, ok := quality.Lower()
+		if !ok {
+			return nil, err
+		}
+		log.Printf("Cannot download %s in %s quality, falling back to %s: %s\n", track.Link, quality, lower, err)
+		quality = lower
+	}
+}
+
+// download downloads a track with deemix in a single quality
+// The audio is returned as soon as it has enough data to be played
+func (d DeemixDownloader) download(ctx context.Context, track Track, quality Quality) (*Audio, error) {
+	// Create a temp dir
+	dirName, err := ioutil.TempDir("", "deemix*")
+	if err != nil {
+		return nil, err
+	}
+	tempDir := &TempDir{Address: dirName}
+	// Download the file. The process is killed if the context is cancelled or the timeout is reached
+	processCtx, cancelProcess := context.WithCancel(ctx)
+	// The timeout only applies until the audio can be played
+	var timedOut int32
+	stopTimeout := func() {}
+	if d.Timeout > 0 {
+		timer := time.AfterFunc(d.Timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			cancelProcess()
+		})
+		stopTimeout = func() {
+			timer.Stop()
+		}
+	}
+	cmd := exec.CommandContext(processCtx, "deemix", "-p", dirName, "-b", string(quality), track.Link)
+	if d.Config != nil {
+		cmd.Env = d.Config.Env()
+	}
+	// deemix prints some of the errors in stdout
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err = cmd.Start()
+	if err != nil {
+		stopTimeout()
+		cancelProcess()
+		tempDir.Delete()
+		return nil, err
+	}
+	download := newAudioDownload()
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			log.Printf("Error on excuting deemix: %s\n", output.String())
+			if atomic.LoadInt32(&timedOut) == 1 && ctx.Err() == nil {
+				err = DownloadTimeoutError
+			} else if known := classifyDeemixOutput(output.String()); known != nil {
+				err = known
+			}
+		}
+		cancelProcess()
+		download.finish(err)
+	}()
+	// Start playing the file while deemix is writing it
+	path, ok := download.waitForFile(*tempDir)
+	stopTimeout()
+	if ok {
+		return &Audio{
+			Path:      path,
+			Quality:   quality,
+			temporary: true,
+			download:  download,
+			cleanup: func() {
+				// Stop deemix before removing its directory
+				_ = cmd.Process.Kill()
+				<-download.done
+				tempDir.Delete()
+			},
+		}, nil
+	}
+	// The download is finished before we could stream it
+	if download.err != nil {
+		tempDir.Delete()
+		return nil, download.err
+	}
+	// Check downloaded file. deemix skips the tracks which it cannot download without failing
+	musics := tempDir.GetMusics()
+	if len(musics) == 0 {
+		tempDir.Delete()
+		if known := classifyDeemixOutput(output.String()); known != nil {
+			log.Printf("deemix did not download %s: %s\n", track.Link, output.String())
+			return nil, known
+		}
+		return nil, MusicNotFoundError
+	}
+	return &Audio{Path: musics[0], Quality: quality, temporary: true, cleanup: tempDir.Delete}, nil
+}
+
+// LocalDownloader serves the audio files in a local directory instead of downloading them
+// It's useful for testing the bot without deemix
+type LocalDownloader struct {
+	// The directory which contains the audio files
+	Directory string
+}
+
+// Download finds the audio file of track in the directory
+// The file which its name (without extension) is the ID of track is chosen.
+// If there is no such file, a file is chosen by the ID of track.
+// The quality is ignored.
+func (d LocalDownloader) Download(ctx context.Context, track Track, _ Quality) (*Audio, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	musics := TempDir{Address: d.Directory}.GetMusics()
+	if len(musics) == 0 {
+		return nil, MusicNotFoundError
+	}
+	id, _ := trackID(track)
+	for _, music := range musics {
+		name := filepath.Base(music)
+		if name[:len(name)-len(filepath.Ext(name))] == strconv.Itoa(id) {
+			return &Audio{Path: music}, nil
+		}
+	}
+	return &Audio{Path: musics[id%len(musics)]}, nil
+}
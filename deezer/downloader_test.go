@@ -0,0 +1,118 @@
+package deezer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeTestFile creates a file with the given size in a directory and returns its path
+func writeTestFile(t *testing.T, directory, name string, size int) string {
+	path := filepath.Join(directory, name)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fileExists checks if a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// useFakeDeemix puts a deemix command in PATH which runs a shell script
+// The script gets the download directory in $dir.
+func useFakeDeemix(t *testing.T, script string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake deemix needs a shell")
+	}
+	directory := t.TempDir()
+	script = "#!/bin/sh\ndir=\"$2\"\n" + script + "\n"
+	if err := os.WriteFile(filepath.Join(directory, "deemix"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", directory+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestDeemixDownloaderTimeoutBeforeStreaming(t *testing.T) {
+	useFakeDeemix(t, "exec sleep 5")
+	downloader := DeemixDownloader{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err := downloader.Download(context.Background(), Track{ID: 1, Link: "https://www.deezer.com/track/1"}, Quality128)
+	if err != DownloadTimeoutError {
+		t.Fatalf("expected DownloadTimeoutError, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("deemix is not killed on timeout")
+	}
+}
+
+func TestDeemixDownloaderTimeoutAfterStreaming(t *testing.T) {
+	// The download keeps going after the audio is playable for longer than the timeout
+	useFakeDeemix(t, "head -c 70000 /dev/zero > \"$dir/1.mp3\"\nsleep 1\nhead -c 1000 /dev/zero >> \"$dir/1.mp3\"")
+	downloader := DeemixDownloader{Timeout: 500 * time.Millisecond}
+	audio, err := downloader.Download(context.Background(), Track{ID: 1, Link: "https://www.deezer.com/track/1"}, Quality128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audio.Close()
+	reader, err := audio.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("expected the download to finish, got %v", err)
+	}
+	if len(data) != 71000 {
+		t.Fatalf("expected 71000 bytes, got %d", len(data))
+	}
+}
+
+func TestLocalDownloader(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"10.mp3", "20.flac", "30.mp3", "notes.txt"} {
+		writeTestFile(t, directory, name, 100)
+	}
+	downloader := LocalDownloader{Directory: directory}
+	tests := []struct {
+		track    Track
+		expected string
+	}{
+		// The file which is named by the ID is chosen
+		{Track{ID: 20}, "20.flac"},
+		{Track{Link: "https://www.deezer.com/track/30"}, "30.mp3"},
+		// Otherwise the ID picks one of the audio files
+		{Track{ID: 4}, "20.flac"},
+		{Track{ID: 6}, "10.mp3"},
+	}
+	for _, test := range tests {
+		audio, err := downloader.Download(context.Background(), test.track, Quality128)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if audio.Path != filepath.Join(directory, test.expected) {
+			t.Errorf("%+v: expected %s, got %s", test.track, test.expected, audio.Path)
+		}
+		// The files of directory must not be removed
+		audio.Close()
+		if !fileExists(audio.Path) {
+			t.Fatalf("%s is removed", audio.Path)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := downloader.Download(ctx, Track{ID: 10}, Quality128); err != context.Canceled {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	empty := LocalDownloader{Directory: t.TempDir()}
+	if _, err := empty.Download(context.Background(), Track{ID: 10}, Quality128); err != MusicNotFoundError {
+		t.Fatalf("expected MusicNotFoundError, got %v", err)
+	}
+}
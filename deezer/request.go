@@ -0,0 +1,92 @@
+package deezer
+
+import (
+	"context"
+	"sync"
+)
+
+// DownloadPriority is the priority of a download in DownloadScheduler
+type DownloadPriority byte
+
+const (
+	// PriorityPrefetch is used for the tracks which will be played later
+	PriorityPrefetch DownloadPriority = iota
+	// PriorityNow is used for the tracks which someone is waiting for
+	PriorityNow
+)
+
+// DownloadRequest holds the options of a download which are not related to the track itself
+// It's passed to the downloaders in the context of download. See WithDownloadRequest.
+type DownloadRequest struct {
+	// OnQueued is called with the 1-based position of download when it has to wait for other downloads
+	// It's only called for PriorityNow downloads and can be nil
+	OnQueued func(position int)
+	// OnRetry is called before a failed download is tried again. attempt is the number of the next attempt
+	// It's only called for PriorityNow downloads and can be nil
+	OnRetry  func(attempt, attempts int, err error)
+	priority DownloadPriority
+	// The scheduler which the download is waiting in. nil if the download is not waiting
+	scheduler *DownloadScheduler
+	mu        sync.Mutex
+}
+
+// NewDownloadRequest creates a DownloadRequest with a priority
+func NewDownloadRequest(priority DownloadPriority) *DownloadRequest {
+	return &DownloadRequest{priority: priority}
+}
+
+// Priority returns the priority of request
+func (r *DownloadRequest) Priority() DownloadPriority {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.priority
+}
+
+// SetPriority changes the priority of request. It also affects the download if it's waiting in a scheduler
+func (r *DownloadRequest) SetPriority(priority DownloadPriority) {
+	r.mu.Lock()
+	r.priority = priority
+	scheduler := r.scheduler
+	r.mu.Unlock()
+	if scheduler != nil {
+		scheduler.reprioritize(r)
+	}
+}
+
+// setScheduler sets the scheduler which the request is waiting in
+func (r *DownloadRequest) setScheduler(scheduler *DownloadScheduler) {
+	r.mu.Lock()
+	r.scheduler = scheduler
+	r.mu.Unlock()
+}
+
+// queued calls OnQueued if the request has PriorityNow
+func (r *DownloadRequest) queued(position int) {
+	if r.OnQueued != nil && r.Priority() == PriorityNow {
+		r.OnQueued(position)
+	}
+}
+
+// retrying calls OnRetry if the request has PriorityNow
+func (r *DownloadRequest) retrying(attempt, attempts int, err error) {
+	if r.OnRetry != nil && r.Priority() == PriorityNow {
+		r.OnRetry(attempt, attempts, err)
+	}
+}
+
+// downloadRequestKey is the context key of DownloadRequest
+type downloadRequestKey struct{}
+
+// WithDownloadRequest attaches a DownloadRequest to a context
+func WithDownloadRequest(ctx context.Context, request *DownloadRequest) context.Context {
+	return context.WithValue(ctx, downloadRequestKey{}, request)
+}
+
+// downloadRequestFromContext gets the DownloadRequest of a context
+// If the context does not have one, a PriorityNow request is returned
+func downloadRequestFromContext(ctx context.Context) *DownloadRequest {
+	if request, ok := ctx.Value(downloadRequestKey{}).(*DownloadRequest); ok {
+		return request
+	}
+	return NewDownloadRequest(PriorityNow)
+}
@@ -0,0 +1,88 @@
+package deezer
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache is an in-memory LRU cache of API results which expire after a while
+// It's safe to use it from multiple goroutines.
+type responseCache struct {
+	// The elements of lru list mapped from their keys
+	entries map[string]*list.Element
+	// Least recently used entries are at the back of the list
+	lru *list.List
+	// The number of lookups which are found or not found in cache
+	hits, misses uint64
+	mu           sync.Mutex
+}
+
+// responseCacheEntry is a cached result
+type responseCacheEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time
+}
+
+// newResponseCache creates an empty responseCache
+func newResponseCache() *responseCache {
+	return &responseCache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// get gets a result from cache. ok is false if it's not cached or it's expired
+func (c *responseCache) get(key string) (value interface{}, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, exists := c.entries[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+	entry := element.Value.(*responseCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	c.hits++
+	return entry.value, true
+}
+
+// put caches a result for ttl
+// The least recently used results are removed if there are more than maxEntries results
+func (c *responseCache) put(key string, value interface{}, ttl time.Duration, maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &responseCacheEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if element, exists := c.entries[key]; exists {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[key] = c.lru.PushFront(entry)
+	}
+	for c.lru.Len() > maxEntries {
+		back := c.lru.Back()
+		c.lru.Remove(back)
+		delete(c.entries, back.Value.(*responseCacheEntry).key)
+	}
+}
+
+// stats returns the number of hits and misses of cache
+func (c *responseCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// normalizeQuery converts the search queries which have the same results to the same text
+// The queries are not case-sensitive and the extra whitespaces are ignored
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
@@ -0,0 +1,53 @@
+package deezer
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RetryDownloader is a Downloader which tries the downloads which fail with transient errors again
+// The delay between the attempts is doubled after each attempt.
+type RetryDownloader struct {
+	// The downloader which downloads the tracks
+	downloader Downloader
+	// The number of times which a download is retried
+	retries int
+	// The delay before the first retry
+	backoff time.Duration
+}
+
+// NewRetryDownloader creates a RetryDownloader which retries the downloads at most retries times
+func NewRetryDownloader(downloader Downloader, retries int, backoff time.Duration) *RetryDownloader {
+	return &RetryDownloader{
+		downloader: downloader,
+		retries:    retries,
+		backoff:    backoff,
+	}
+}
+
+// Download downloads a track and retries it if it fails with a transient error
+// The retries are reported to the DownloadRequest of context
+func (r *RetryDownloader) Download(ctx context.Context, track Track, quality Quality) (*Audio, error) {
+	attempts := r.retries + 1
+	delay := r.backoff
+	for attempt := 1; ; attempt++ {
+		audio, err := r.downloader.Download(ctx, track, quality)
+		if err == nil || attempt == attempts || !isTransientError(err) || ctx.Err() != nil {
+			return audio, err
+		}
+		log.Printf("Cannot download %s (attempt %d/%d), retrying in %s: %s\n", track.Link, attempt, attempts, delay, err)
+		downloadRequestFromContext(ctx).retrying(attempt+1, attempts, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// isTransientError checks if a download error might not happen if we try again
+func isTransientError(err error) bool {
+	return err == NetworkError || err == DownloadTimeoutError
+}
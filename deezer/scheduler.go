@@ -0,0 +1,168 @@
+package deezer
+
+import (
+	"context"
+	"sync"
+)
+
+// waitingDownload is a download which is waiting for a worker
+type waitingDownload struct {
+	request *DownloadRequest
+	// The order of download in the downloads with same priority
+	sequence uint64
+	// start is closed when the download gets a worker
+	start chan struct{}
+}
+
+// before checks if this download must be started before the other one
+func (d *waitingDownload) before(other *waitingDownload) bool {
+	priority, otherPriority := d.request.Priority(), other.request.Priority()
+	if priority != otherPriority {
+		return priority > otherPriority
+	}
+	return d.sequence < other.sequence
+}
+
+// DownloadScheduler is a Downloader which limits the number of concurrent downloads
+// Other downloads wait in a queue. PriorityNow downloads are started before PriorityPrefetch ones
+// and the downloads with same priority are started in order.
+// A worker is kept until the audio file is downloaded completely, even if the audio is returned before it.
+// It's safe to use it from multiple goroutines.
+type DownloadScheduler struct {
+	// The downloader which downloads the tracks
+	downloader Downloader
+	// The maximum number of concurrent downloads
+	workers int
+	// The number of running downloads
+	running int
+	// The downloads which are waiting for a worker
+	waiting []*waitingDownload
+	// The sequence of next waiting download
+	sequence uint64
+	mu       sync.Mutex
+}
+
+// NewDownloadScheduler creates a DownloadScheduler which runs at most workers downloads at once
+func NewDownloadScheduler(downloader Downloader, workers int) *DownloadScheduler {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &DownloadScheduler{
+		downloader: downloader,
+		workers:    workers,
+	}
+}
+
+// Download waits for a worker and downloads the track
+// The priority of download is read from the DownloadRequest of context. Downloads without it have PriorityNow.
+func (s *DownloadScheduler) Download(ctx context.Context, track Track, quality Quality) (*Audio, error) {
+	if err := s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	audio, err := s.downloader.Download(ctx, track, quality)
+	if err == nil && audio.Downloading() {
+		// Keep the worker until the file is downloaded
+		go func() {
+			_ = audio.Wait()
+			s.release()
+		}()
+	} else {
+		s.release()
+	}
+	return audio, err
+}
+
+// acquire waits until a worker is free and takes it
+func (s *DownloadScheduler) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running < s.workers && len(s.waiting) == 0 {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	// Wait in the queue
+	download := &waitingDownload{
+		request:  downloadRequestFromContext(ctx),
+		sequence: s.sequence,
+		start:    make(chan struct{}),
+	}
+	s.sequence++
+	s.waiting = append(s.waiting, download)
+	download.request.setScheduler(s)
+	position := s.position(download)
+	s.mu.Unlock()
+	download.request.queued(position)
+	select {
+	case <-download.start:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		started := s.removeWaiting(download)
+		s.mu.Unlock()
+		if started { // We got the worker right when the context was cancelled
+			s.release()
+		}
+		return ctx.Err()
+	}
+}
+
+// release frees a worker and starts the next waiting downloads
+func (s *DownloadScheduler) release() {
+	s.mu.Lock()
+	s.running--
+	for s.running < s.workers && len(s.waiting) > 0 {
+		next := 0
+		for i, download := range s.waiting {
+			if download.before(s.waiting[next]) {
+				next = i
+			}
+		}
+		download := s.waiting[next]
+		s.removeWaiting(download)
+		s.running++
+		close(download.start)
+	}
+	s.mu.Unlock()
+}
+
+// removeWaiting removes a download from the waiting list
+// It returns true if the download was not in the list, which means it's started
+// s.mu must be locked when calling this function
+func (s *DownloadScheduler) removeWaiting(download *waitingDownload) (started bool) {
+	for i, waiting := range s.waiting {
+		if waiting == download {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			download.request.setScheduler(nil)
+			return false
+		}
+	}
+	return true
+}
+
+// position returns the 1-based position of a waiting download in the queue
+// s.mu must be locked when calling this function
+func (s *DownloadScheduler) position(download *waitingDownload) int {
+	position := 1
+	for _, waiting := range s.waiting {
+		if waiting != download && waiting.before(download) {
+			position++
+		}
+	}
+	return position
+}
+
+// reprioritize updates the position of a request which its priority is changed
+func (s *DownloadScheduler) reprioritize(request *DownloadRequest) {
+	s.mu.Lock()
+	position := 0
+	for _, waiting := range s.waiting {
+		if waiting.request == request {
+			position = s.position(waiting)
+			break
+		}
+	}
+	s.mu.Unlock()
+	if position != 0 {
+		request.queued(position)
+	}
+}
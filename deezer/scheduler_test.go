@@ -0,0 +1,253 @@
+package deezer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedDownloader is a Downloader which blocks each download until it's released
+type gatedDownloader struct {
+	// The IDs of tracks which are started
+	started chan int
+	// The channels which release the downloads, mapped from track IDs
+	gates map[int]chan struct{}
+	mu    sync.Mutex
+}
+
+func newGatedDownloader() *gatedDownloader {
+	return &gatedDownloader{
+		started: make(chan int, 100),
+		gates:   make(map[int]chan struct{}),
+	}
+}
+
+// gate returns the channel which releases the download of a track
+func (d *gatedDownloader) gate(id int) chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.gates[id]; !exists {
+		d.gates[id] = make(chan struct{})
+	}
+	return d.gates[id]
+}
+
+func (d *gatedDownloader) Download(ctx context.Context, track Track, _ Quality) (*Audio, error) {
+	d.started <- track.ID
+	select {
+	case <-d.gate(track.ID):
+		return &Audio{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// release lets the download of a track finish
+func (d *gatedDownloader) release(id int) {
+	close(d.gate(id))
+}
+
+// expectStarted waits for the next started download and checks its track
+func (d *gatedDownloader) expectStarted(t *testing.T, id int) {
+	t.Helper()
+	select {
+	case started := <-d.started:
+		if started != id {
+			t.Fatalf("expected %d to start, got %d", id, started)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%d is not started", id)
+	}
+}
+
+// expectNothingStarted checks that no download starts for a while
+func (d *gatedDownloader) expectNothingStarted(t *testing.T) {
+	t.Helper()
+	select {
+	case started := <-d.started:
+		t.Fatalf("%d is started unexpectedly", started)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// waitingCount returns the number of downloads which are waiting in scheduler
+func waitingCount(s *DownloadScheduler) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiting)
+}
+
+// waitForWaiting waits until count downloads are waiting in scheduler
+func waitForWaiting(t *testing.T, s *DownloadScheduler, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for waitingCount(s) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiting downloads, got %d", count, waitingCount(s))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// scheduleDownload starts a download with a priority in background
+// The result of download is sent to the returned channel
+func scheduleDownload(s *DownloadScheduler, ctx context.Context, id int, request *DownloadRequest) chan error {
+	result := make(chan error, 1)
+	if request != nil {
+		ctx = WithDownloadRequest(ctx, request)
+	}
+	go func() {
+		_, err := s.Download(ctx, Track{ID: id}, Quality128)
+		result <- err
+	}()
+	return result
+}
+
+func TestDownloadSchedulerWorkers(t *testing.T) {
+	downloader := newGatedDownloader()
+	scheduler := NewDownloadScheduler(downloader, 2)
+	for id := 1; id <= 3; id++ {
+		scheduleDownload(scheduler, context.Background(), id, nil)
+		if id <= 2 {
+			downloader.expectStarted(t, id)
+		}
+	}
+	waitForWaiting(t, scheduler, 1)
+	downloader.expectNothingStarted(t)
+	downloader.release(1)
+	downloader.expectStarted(t, 3)
+	downloader.release(2)
+	downloader.release(3)
+}
+
+func TestDownloadSchedulerPriority(t *testing.T) {
+	downloader := newGatedDownloader()
+	scheduler := NewDownloadScheduler(downloader, 1)
+	scheduleDownload(scheduler, context.Background(), 1, nil)
+	downloader.expectStarted(t, 1)
+	scheduleDownload(scheduler, context.Background(), 2, NewDownloadRequest(PriorityPrefetch))
+	waitForWaiting(t, scheduler, 1)
+	scheduleDownload(scheduler, context.Background(), 3, NewDownloadRequest(PriorityPrefetch))
+	waitForWaiting(t, scheduler, 2)
+	// The track which is needed now is queued after the prefetches, but it's started before them
+	positions := make(chan int, 10)
+	request := NewDownloadRequest(PriorityNow)
+	request.OnQueued = func(position int) {
+		positions <- position
+	}
+	scheduleDownload(scheduler, context.Background(), 4, request)
+	waitForWaiting(t, scheduler, 3)
+	if position := <-positions; position != 1 {
+		t.Fatalf("expected position 1, got %d", position)
+	}
+	downloader.release(1)
+	downloader.expectStarted(t, 4)
+	// The prefetches are started in order
+	downloader.release(4)
+	downloader.expectStarted(t, 2)
+	downloader.release(2)
+	downloader.expectStarted(t, 3)
+	downloader.release(3)
+}
+
+func TestDownloadSchedulerPromotion(t *testing.T) {
+	downloader := newGatedDownloader()
+	scheduler := NewDownloadScheduler(downloader, 1)
+	scheduleDownload(scheduler, context.Background(), 1, nil)
+	downloader.expectStarted(t, 1)
+	scheduleDownload(scheduler, context.Background(), 2, NewDownloadRequest(PriorityPrefetch))
+	waitForWaiting(t, scheduler, 1)
+	positions := make(chan int, 10)
+	request := NewDownloadRequest(PriorityPrefetch)
+	request.OnQueued = func(position int) {
+		positions <- position
+	}
+	scheduleDownload(scheduler, context.Background(), 3, request)
+	waitForWaiting(t, scheduler, 2)
+	// Prefetches don't report their position
+	select {
+	case position := <-positions:
+		t.Fatalf("prefetch reported position %d", position)
+	default:
+	}
+	// The user wants to play the prefetched track now
+	request.SetPriority(PriorityNow)
+	select {
+	case position := <-positions:
+		if position != 1 {
+			t.Fatalf("expected position 1 after promotion, got %d", position)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("promotion did not report the position")
+	}
+	downloader.release(1)
+	downloader.expectStarted(t, 3)
+	downloader.release(3)
+	downloader.expectStarted(t, 2)
+	downloader.release(2)
+	// Changing the priority after the download is started does nothing
+	request.SetPriority(PriorityPrefetch)
+}
+
+func TestDownloadSchedulerCancelWhileWaiting(t *testing.T) {
+	downloader := newGatedDownloader()
+	scheduler := NewDownloadScheduler(downloader, 1)
+	scheduleDownload(scheduler, context.Background(), 1, nil)
+	downloader.expectStarted(t, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := scheduleDownload(scheduler, ctx, 2, nil)
+	waitForWaiting(t, scheduler, 1)
+	cancel()
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Fatalf("expected canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled download is still waiting")
+	}
+	if waitingCount(scheduler) != 0 {
+		t.Fatal("cancelled download is still in the queue")
+	}
+	// The worker goes to the next download, not the cancelled one
+	scheduleDownload(scheduler, context.Background(), 3, nil)
+	waitForWaiting(t, scheduler, 1)
+	downloader.release(1)
+	downloader.expectStarted(t, 3)
+	downloader.release(3)
+}
+
+func TestDownloadSchedulerCancelWhenStarted(t *testing.T) {
+	scheduler := NewDownloadScheduler(newGatedDownloader(), 1)
+	if err := scheduler.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- scheduler.acquire(ctx)
+	}()
+	waitForWaiting(t, scheduler, 1)
+	// Cancel the download and give it the worker of first download at the same time, like release does.
+	// The waiting download sees the cancellation before the start, then finds out that it's started
+	// when it locks the scheduler.
+	scheduler.mu.Lock()
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	download := scheduler.waiting[0]
+	scheduler.removeWaiting(download)
+	close(download.start)
+	scheduler.mu.Unlock()
+	if err := <-result; err == nil {
+		// It might have seen the start first. Then the worker is its own
+		scheduler.release()
+	}
+	// No worker must be leaked or freed twice
+	scheduler.mu.Lock()
+	running := scheduler.running
+	scheduler.mu.Unlock()
+	if running != 0 {
+		t.Fatalf("expected no running downloads, got %d", running)
+	}
+}
@@ -0,0 +1,188 @@
+package deezer
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// searchPrefixes maps the prefixes of search queries to the type of objects which they search
+// The queries without these prefixes search the tracks
+var searchPrefixes = map[string]ResourceType{
+	"album:":    ResourceAlbum,
+	"artist:":   ResourceArtist,
+	"playlist:": ResourcePlaylist,
+}
+
+// SearchResultDetail is a piece of information of a search result, like the artist of an album
+type SearchResultDetail struct {
+	Name  string
+	Value string
+}
+
+// SearchResult is a track, album, artist or playlist which is found in a search
+type SearchResult struct {
+	// The type of the object
+	Type ResourceType
+	// The title of track, album or playlist or the name of artist
+	Title string
+	// The link of object which can be played
+	Link string
+	// Other info of object in order
+	Details []SearchResultDetail
+}
+
+// Append writes the search result in a message
+// All types of results are shown in the same format
+func (r SearchResult) Append(builder *strings.Builder) {
+	builder.WriteString("\n")
+	switch r.Type {
+	case ResourceTrack:
+		builder.WriteString("Title")
+	case ResourceAlbum:
+		builder.WriteString("Album")
+	case ResourceArtist:
+		builder.WriteString("Artist")
+	case ResourcePlaylist:
+		builder.WriteString("Playlist")
+	}
+	builder.WriteString(": ")
+	builder.WriteString(r.Title)
+	for _, detail := range r.Details {
+		builder.WriteString("\n")
+		builder.WriteString(detail.Name)
+		builder.WriteString(": ")
+		builder.WriteString(detail.Value)
+	}
+	builder.WriteString("\nLink:\n`")
+	builder.WriteString(r.Link)
+	builder.WriteString("`\n\n")
+}
+
+// SearchResult converts a searched track to SearchResult
+func (t SearchedTrack) SearchResult() SearchResult {
+	return SearchResult{
+		Type:  ResourceTrack,
+		Title: t.Title,
+		Link:  t.Link,
+		Details: []SearchResultDetail{
+			{Name: "Album", Value: t.Album},
+			{Name: "Artist", Value: t.Artist},
+			{Name: "Duration", Value: t.FormatDuration()},
+		},
+	}
+}
+
+// ParseSearchQuery finds the type of objects which a query searches
+// "album:", "artist:" and "playlist:" prefixes search the albums, artists and playlists.
+// Other queries search the tracks. They can use the advanced search of deezer like artist:"x" track:"y".
+// Because of that, the prefixes which are followed by a quote are considered the advanced search of tracks.
+func ParseSearchQuery(text string) (ResourceType, string) {
+	text = strings.TrimSpace(text)
+	lower := strings.ToLower(text)
+	for prefix, resourceType := range searchPrefixes {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+		query := strings.TrimSpace(text[len(prefix):])
+		if query == "" || query[0] == '"' {
+			break
+		}
+		return resourceType, query
+	}
+	return ResourceTrack, text
+}
+
+// Search searches deezer with a query which ParseSearchQuery understands
+func (c *Client) Search(text string) ([]SearchResult, error) {
+	resourceType, query := ParseSearchQuery(text)
+	if resourceType == ResourceTrack {
+		tracks, err := c.SearchTrack(query)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]SearchResult, len(tracks))
+		for i, track := range tracks {
+			result[i] = track.SearchResult()
+		}
+		return result, nil
+	}
+	return c.SearchCollection(resourceType, query)
+}
+
+// SearchCollection searches deezer for albums, artists or playlists by keyword
+// The results are cached like SearchTrack
+func (c *Client) SearchCollection(resourceType ResourceType, keyword string) ([]SearchResult, error) {
+	keyword = normalizeQuery(keyword)
+	cacheKey := "search:" + resourceType.String() + ":" + keyword
+	if cached, ok := c.cached(cacheKey); ok {
+		return append([]SearchResult(nil), cached.([]SearchResult)...), nil
+	}
+	var respRaw collectionSearchResponse
+	err := c.get("/search/"+resourceType.String()+"?q="+url.QueryEscape(keyword), &respRaw)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SearchResult, 0, c.MaxSearchEntries)
+	for _, entry := range respRaw.Data {
+		if len(result) >= c.MaxSearchEntries {
+			break
+		}
+		if entry.Link == "" {
+			continue
+		}
+		result = append(result, entry.SearchResult(resourceType))
+	}
+	c.store(cacheKey, append([]SearchResult(nil), result...))
+	return result, nil
+}
+
+// collectionSearchResponse is the response of album, artist and playlist searches
+type collectionSearchResponse struct {
+	Data []collectionInfoResponse `json:"data"`
+}
+
+// collectionInfoResponse is an album, artist or playlist in search results
+// Each type only fills some of the fields
+type collectionInfoResponse struct {
+	Title    string `json:"title"`
+	Name     string `json:"name"`
+	Link     string `json:"link"`
+	Tracks   int    `json:"nb_tracks"`
+	Albums   int    `json:"nb_album"`
+	Fans     int    `json:"nb_fan"`
+	Explicit bool   `json:"explicit_lyrics"`
+	Artist   struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+// SearchResult converts collectionInfoResponse to SearchResult
+func (c collectionInfoResponse) SearchResult(resourceType ResourceType) SearchResult {
+	result := SearchResult{Type: resourceType, Title: c.Title, Link: c.Link}
+	switch resourceType {
+	case ResourceAlbum:
+		result.Details = []SearchResultDetail{
+			{Name: "Artist", Value: c.Artist.Name},
+			{Name: "Tracks", Value: strconv.Itoa(c.Tracks)},
+		}
+		if c.Explicit {
+			result.Details = append(result.Details, SearchResultDetail{Name: "Explicit", Value: "yes"})
+		}
+	case ResourceArtist:
+		result.Title = c.Name
+		result.Details = []SearchResultDetail{
+			{Name: "Albums", Value: strconv.Itoa(c.Albums)},
+			{Name: "Fans", Value: strconv.Itoa(c.Fans)},
+		}
+	case ResourcePlaylist:
+		result.Details = []SearchResultDetail{
+			{Name: "Creator", Value: c.User.Name},
+			{Name: "Tracks", Value: strconv.Itoa(c.Tracks)},
+		}
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package deezer
+
+import (
+	"Deemix-Discord-Bot/spotify"
+	"errors"
+	"net/url"
+)
+
+// GetTrackByISRC gets a single track's info by its International Standard Recording Code
+func (c *Client) GetTrackByISRC(isrc string) (Track, error) {
+	var result trackInfoResponse
+	err := c.get("/track/isrc:"+url.PathEscape(isrc), &result)
+	if err != nil {
+		return Track{}, err
+	}
+	if result.Link == "" {
+		return Track{}, EmptyTrackError
+	}
+	return result.Track(), nil
+}
+
+// MatchSpotifyTrack finds the deezer track which is the same as a spotify track
+// At first, it tries to find the track by ISRC, then it falls back to searching the artist and title
+func (c *Client) MatchSpotifyTrack(track spotify.Track) (Track, error) {
+	if track.ISRC != "" {
+		if result, err := c.GetTrackByISRC(track.ISRC); err == nil {
+			return result, nil
+		}
+	}
+	// Use the advanced search at first, then search the keyword
+	tracks, _ := c.SearchTrack(`artist:"` + track.Artist + `" track:"` + track.Title + `"`)
+	if len(tracks) == 0 {
+		tracks, _ = c.SearchTrack(track.Artist + " " + track.Title)
+	}
+	if len(tracks) == 0 {
+		return Track{}, errors.New("cannot find " + track.String() + " in deezer")
+	}
+	return tracks[0].Track, nil
+}
+
+// tracksFromSpotify gets the tracks in a spotify link and matches them with the deezer tracks
+// The tracks which cannot be found in deezer are ignored
+func (c *Client) tracksFromSpotify(u *url.URL, options LinkOptions) (TrackList, error) {
+	if c.Spotify == nil {
+		return TrackList{}, errors.New("spotify links are not enabled")
+	}
+	resource, err := spotify.ClassifyUrl(u)
+	if err != nil {
+		return TrackList{}, err
+	}
+	// Get the list of tracks from spotify
+	var spotifyTracks spotify.TrackList
+	switch resource.Type {
+	case spotify.ResourceTrack:
+		track, err := c.Spotify.GetTrack(resource.ID)
+		if err != nil {
+			return TrackList{}, err
+		}
+		result, err := c.MatchSpotifyTrack(track)
+		if err != nil {
+			return TrackList{}, err
+		}
+		return TrackList{Tracks: []Track{result}}, nil
+	case spotify.ResourceAlbum:
+		spotifyTracks, err = c.Spotify.GetAlbum(resource.ID)
+	case spotify.ResourcePlaylist:
+		spotifyTracks, err = c.Spotify.GetPlaylist(resource.ID, options.MaxPlaylistTracks)
+	}
+	if err != nil {
+		return TrackList{}, err
+	}
+	// Match the tracks
+	result := TrackList{
+		Name:   spotifyTracks.Name,
+		Tracks: make([]Track, 0, len(spotifyTracks.Tracks)),
+	}
+	for _, match := range c.matchSpotifyTracks(spotifyTracks.Tracks, options.OnProgress) {
+		if match.err != nil {
+			result.Missing++
+			continue
+		}
+		result.Tracks = append(result.Tracks, match.track)
+	}
+	if len(result.Tracks) == 0 {
+		return TrackList{}, errors.New("none of the tracks were found in deezer")
+	}
+	return result, nil
+}
+
+// spotifyMatch is the result of matching a spotify track
+type spotifyMatch struct {
+	track Track
+	err   error
+}
+
+// matchSpotifyTracks matches a list of spotify tracks with deezer tracks in order
+// At most SpotifyMatchWorkers tracks are matched at once, so we don't exceed the quota of deezer very fast.
+// onProgress is called after each track is matched if it's not nil.
+func (c *Client) matchSpotifyTracks(tracks []spotify.Track, onProgress func(matched, total int)) []spotifyMatch {
+	workers := c.SpotifyMatchWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(tracks) {
+		workers = len(tracks)
+	}
+	result := make([]spotifyMatch, len(tracks))
+	jobs := make(chan int)
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range jobs {
+				result[index].track, result[index].err = c.MatchSpotifyTrack(tracks[index])
+				done <- struct{}{}
+			}
+		}()
+	}
+	go func() {
+		for index := range tracks {
+			jobs <- index
+		}
+		close(jobs)
+	}()
+	for matched := 1; matched <= len(tracks); matched++ {
+		<-done
+		if onProgress != nil {
+			onProgress(matched, len(tracks))
+		}
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+package deezer
+
+import (
+	"Deemix-Discord-Bot/spotify"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDeezer is a fake deezer API which knows some tracks by ISRC and some search queries
+type fakeDeezer struct {
+	// Tracks mapped from their ISRC
+	isrc map[string]trackInfoResponse
+	// Search results mapped from the queries
+	search map[string][]trackInfoResponse
+	// The requested paths and queries in order
+	requests []string
+	mu       sync.Mutex
+}
+
+func (f *fakeDeezer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/track/isrc:"):
+		isrc := strings.TrimPrefix(r.URL.Path, "/track/isrc:")
+		f.requests = append(f.requests, "isrc:"+isrc)
+		track, exists := f.isrc[isrc]
+		if !exists {
+			_, _ = w.Write([]byte(`{"error":{"type":"DataException","message":"no data","code":800}}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(track)
+	case r.URL.Path == "/search":
+		query := r.URL.Query().Get("q")
+		f.requests = append(f.requests, "search:"+query)
+		_ = json.NewEncoder(w).Encode(trackSearchResponse{Data: f.search[query]})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fakeTrack creates the response of a deezer track
+func fakeTrack(id int, title string) trackInfoResponse {
+	track := trackInfoResponse{ID: id, Title: title, Link: "https://www.deezer.com/track/" + title}
+	track.Artist.Name = "Artist"
+	return track
+}
+
+// newFakeSpotify creates a spotify client which uses a fake API with an album
+func newFakeSpotify(t *testing.T, album string, tracks []string) *spotify.Client {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/token":
+			_, _ = w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+		case r.URL.Path == "/albums/"+album:
+			items := make([]string, len(tracks))
+			for i := range tracks {
+				items[i] = `{"id":"` + tracks[i] + `"}`
+			}
+			_, _ = w.Write([]byte(`{"name":"Album","tracks":{"items":[` + strings.Join(items, ",") + `]}}`))
+		case r.URL.Path == "/tracks":
+			ids := strings.Split(r.URL.Query().Get("ids"), ",")
+			items := make([]string, len(ids))
+			for i, id := range ids {
+				items[i] = `{"id":"` + id + `","name":"` + id + `","artists":[{"name":"Artist"}],"external_ids":{"isrc":"` + id + `"}}`
+			}
+			_, _ = w.Write([]byte(`{"tracks":[` + strings.Join(items, ",") + `]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := spotify.NewClient("id", "secret")
+	client.AccountsURL = server.URL
+	client.APIURL = server.URL
+	return client
+}
+
+func TestMatchSpotifyTrackByISRC(t *testing.T) {
+	fake := &fakeDeezer{isrc: map[string]trackInfoResponse{"USRC1": fakeTrack(1, "Hit")}}
+	client := newTestClient(t, fake)
+	track, err := client.MatchSpotifyTrack(spotify.Track{Title: "Hit", Artist: "Artist", ISRC: "USRC1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != 1 {
+		t.Fatalf("expected track 1, got %+v", track)
+	}
+	if len(fake.requests) != 1 {
+		t.Fatalf("expected only the ISRC request, got %v", fake.requests)
+	}
+}
+
+func TestMatchSpotifyTrackFallback(t *testing.T) {
+	fake := &fakeDeezer{search: map[string][]trackInfoResponse{
+		`artist:"artist" track:"advanced"`: {fakeTrack(2, "Advanced")},
+		"artist plain":                     {fakeTrack(3, "Plain")},
+	}}
+	client := newTestClient(t, fake)
+	// Found by the advanced search
+	track, err := client.MatchSpotifyTrack(spotify.Track{Title: "Advanced", Artist: "Artist", ISRC: "MISS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != 2 {
+		t.Fatalf("expected track 2, got %+v", track)
+	}
+	expected := []string{"isrc:MISS", `search:artist:"artist" track:"advanced"`}
+	if strings.Join(fake.requests, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected requests %v, got %v", expected, fake.requests)
+	}
+	// Found by the plain search
+	fake.requests = nil
+	track, err = client.MatchSpotifyTrack(spotify.Track{Title: "Plain", Artist: "Artist", ISRC: "MISS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != 3 {
+		t.Fatalf("expected track 3, got %+v", track)
+	}
+	expected = []string{"isrc:MISS", `search:artist:"artist" track:"plain"`, "search:artist plain"}
+	if strings.Join(fake.requests, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected requests %v, got %v", expected, fake.requests)
+	}
+	// Not found at all
+	if _, err = client.MatchSpotifyTrack(spotify.Track{Title: "Nothing", Artist: "Artist"}); err == nil {
+		t.Fatal("expected an error for a missing track")
+	}
+}
+
+func TestTracksFromSpotifyMissing(t *testing.T) {
+	fake := &fakeDeezer{
+		isrc: map[string]trackInfoResponse{
+			"ONE":   fakeTrack(1, "One"),
+			"THREE": fakeTrack(3, "Three"),
+			"FOUR":  fakeTrack(4, "Four"),
+		},
+	}
+	client := newTestClient(t, fake)
+	client.Spotify = newFakeSpotify(t, "album1", []string{"ONE", "TWO", "THREE", "FOUR"})
+	client.SpotifyMatchWorkers = 2
+	var progress []int
+	tracks, err := client.KeywordToTracks("https://open.spotify.com/album/album1", LinkOptions{
+		OnProgress: func(matched, total int) {
+			if total != 4 {
+				t.Errorf("expected 4 tracks in progress, got %d", total)
+			}
+			progress = append(progress, matched)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracks.Name != "Album" || tracks.Missing != 1 {
+		t.Fatalf("expected Album with one missing track, got %+v", tracks)
+	}
+	// The order of album must be kept even though the tracks are matched concurrently
+	if len(tracks.Tracks) != 3 || tracks.Tracks[0].ID != 1 || tracks.Tracks[1].ID != 3 || tracks.Tracks[2].ID != 4 {
+		t.Fatalf("unexpected tracks %+v", tracks.Tracks)
+	}
+	if len(progress) != 4 || progress[3] != 4 {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+}
@@ -0,0 +1,178 @@
+package deezer
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// minStreamSize is the number of bytes which must be downloaded before starting to play a file
+const minStreamSize = 64 * 1024
+
+// streamPollInterval is the interval which a growing file is checked for new data
+const streamPollInterval = 100 * time.Millisecond
+
+// audioDownload is the state of a download which is still writing its audio file
+type audioDownload struct {
+	// done is closed when the download is finished
+	done chan struct{}
+	// The error of download. Only valid after done is closed
+	err error
+}
+
+// newAudioDownload creates an unfinished download
+func newAudioDownload() *audioDownload {
+	return &audioDownload{done: make(chan struct{})}
+}
+
+// finish marks the download as finished with an error (or nil if successful)
+func (d *audioDownload) finish(err error) {
+	d.err = err
+	close(d.done)
+}
+
+// finished checks if the download is finished without blocking
+func (d *audioDownload) finished() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForFile waits until an audio file in directory has enough data to be streamed
+// It returns false if the download is finished before that
+func (d *audioDownload) waitForFile(directory TempDir) (string, bool) {
+	for {
+		if d.finished() {
+			return "", false
+		}
+		for _, music := range directory.GetMusics() {
+			if info, err := os.Stat(music); err == nil && info.Size() >= minStreamSize {
+				return music, true
+			}
+		}
+		select {
+		case <-d.done:
+			return "", false
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// growingFile reads an audio file which is still being written
+// When it reaches the end of file, it waits for more data until the download is finished.
+// If the download fails, the error of download is returned after the written data is read.
+type growingFile struct {
+	file     *os.File
+	download *audioDownload
+	// The position which the next read starts from
+	offset int64
+	// The size of tags at the beginning of file when we read it last time. -1 if unknown
+	headerSize int64
+	// closed is closed when the reader is closed to stop the waiting reads
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// openGrowingFile opens a file which is being written by download
+func openGrowingFile(path string, download *audioDownload) (*growingFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &growingFile{
+		file:       file,
+		download:   download,
+		headerSize: -1,
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// Read reads the next bytes of file and waits if they are not written yet
+func (f *growingFile) Read(p []byte) (int, error) {
+	for {
+		f.followHeader()
+		// Check it before reading to not miss the data which is written right before finishing
+		finished := f.download.finished()
+		n, err := f.file.ReadAt(p, f.offset)
+		f.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != io.EOF {
+			return 0, err
+		}
+		if finished {
+			if f.download.err != nil {
+				return 0, f.download.err
+			}
+			return 0, io.EOF
+		}
+		select {
+		case <-f.download.done:
+		case <-f.closed:
+			return 0, os.ErrClosed
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+// followHeader moves the offset if the tags at the beginning of file have changed
+// deemix writes the tags after downloading the audio, which shifts the data which we have not read yet
+func (f *growingFile) followHeader() {
+	size, ok := audioHeaderSize(f.file)
+	if !ok {
+		return
+	}
+	if f.headerSize != -1 && size != f.headerSize && f.offset >= f.headerSize {
+		f.offset += size - f.headerSize
+	}
+	f.headerSize = size
+}
+
+// Close closes the file and stops the waiting reads
+func (f *growingFile) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.closed)
+	})
+	return f.file.Close()
+}
+
+// audioHeaderSize returns the size of the tags at the beginning of an audio file,
+// which are ID3v2 tags in mp3 files and metadata blocks in flac files
+// ok is false if the tags are not written completely
+func audioHeaderSize(file io.ReaderAt) (size int64, ok bool) {
+	var header [10]byte
+	if _, err := file.ReadAt(header[:4], 0); err != nil {
+		return 0, false
+	}
+	switch {
+	case string(header[:3]) == "ID3":
+		if _, err := file.ReadAt(header[:], 0); err != nil {
+			return 0, false
+		}
+		// The size is a 28 bit synchsafe integer which does not include the header
+		size = int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+		size += 10
+		if header[5]&0x10 != 0 { // Footer
+			size += 10
+		}
+		return size, true
+	case string(header[:4]) == "fLaC":
+		offset := int64(4)
+		for {
+			if _, err := file.ReadAt(header[:4], offset); err != nil {
+				return 0, false
+			}
+			offset += 4 + (int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3]))
+			if header[0]&0x80 != 0 { // Last metadata block
+				return offset, true
+			}
+		}
+	default:
+		return 0, true
+	}
+}
@@ -0,0 +1,192 @@
+package deezer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// id3Header creates an ID3v2 tag with size bytes of padding after its header
+func id3Header(size int) []byte {
+	header := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, make([]byte, size)...)
+}
+
+// flacHeader creates the flac signature and a metadata block for each size in sizes
+func flacHeader(sizes ...int) []byte {
+	header := []byte("fLaC")
+	for i, size := range sizes {
+		blockType := byte(0)
+		if i == len(sizes)-1 {
+			blockType = 0x80
+		}
+		header = append(header, blockType, byte(size>>16), byte(size>>8), byte(size))
+		header = append(header, make([]byte, size)...)
+	}
+	return header
+}
+
+func TestAudioHeaderSize(t *testing.T) {
+	withFooter := id3Header(300)
+	withFooter[5] = 0x10
+	tests := []struct {
+		name string
+		data []byte
+		size int64
+		ok   bool
+	}{
+		{"no tags", []byte("plain audio data"), 0, true},
+		{"id3", append(id3Header(300), 1, 2, 3), 310, true},
+		{"id3 with footer", withFooter, 320, true},
+		{"incomplete id3 header", []byte("ID3\x04\x00"), 0, false},
+		{"flac", append(flacHeader(34, 100), 1, 2, 3), 4 + 4 + 34 + 4 + 100, true},
+		{"incomplete flac", flacHeader(34, 100)[:40], 0, false},
+		{"empty", nil, 0, false},
+	}
+	for _, test := range tests {
+		size, ok := audioHeaderSize(bytes.NewReader(test.data))
+		if ok != test.ok || (ok && size != test.size) {
+			t.Errorf("%s: expected %d %v, got %d %v", test.name, test.size, test.ok, size, ok)
+		}
+	}
+}
+
+// openTestDownload writes data in a file and opens it as an audio which is still downloading
+func openTestDownload(t *testing.T, data []byte) (string, *audioDownload, io.ReadCloser) {
+	path := filepath.Join(t.TempDir(), "1.mp3")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	download := newAudioDownload()
+	reader, err := (&Audio{Path: path, download: download}).Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = reader.Close()
+	})
+	return path, download, reader
+}
+
+// appendFile appends data to the end of a file
+// It's called from other goroutines, so it doesn't stop the test on errors
+func appendFile(t *testing.T, path string, data []byte) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = file.Write(data); err != nil {
+		t.Error(err)
+	}
+	_ = file.Close()
+}
+
+func TestGrowingFileWaitsForData(t *testing.T) {
+	path, download, reader := openTestDownload(t, []byte("abc"))
+	go func() {
+		time.Sleep(2 * streamPollInterval)
+		appendFile(t, path, []byte("def"))
+		download.finish(nil)
+	}()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abcdef" {
+		t.Fatalf("expected abcdef, got %q", data)
+	}
+}
+
+func TestGrowingFileTagsPrepended(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"id3", id3Header(50)},
+		{"flac", flacHeader(34, 20)},
+	}
+	for _, test := range tests {
+		path, download, reader := openTestDownload(t, []byte("abcdef"))
+		part := make([]byte, 3)
+		if _, err := io.ReadFull(reader, part); err != nil {
+			t.Fatal(err)
+		}
+		// deemix rewrites the file with the tags when the audio is downloaded
+		data := append(append([]byte(nil), test.header...), []byte("abcdefghi")...)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		download.finish(nil)
+		rest, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(part)+string(rest) != "abcdefghi" {
+			t.Errorf("%s: expected abcdefghi, got %q", test.name, string(part)+string(rest))
+		}
+	}
+}
+
+func TestGrowingFileTagsGrow(t *testing.T) {
+	// The tags which are written before streaming might be replaced with bigger ones
+	path, download, reader := openTestDownload(t, append(id3Header(10), []byte("abcdef")...))
+	part := make([]byte, 23)
+	if _, err := io.ReadFull(reader, part); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append(id3Header(40), []byte("abcdefghi")...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	download.finish(nil)
+	rest, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(part[20:])+string(rest) != "abcdefghi" {
+		t.Fatalf("expected abcdefghi, got %q", string(part[20:])+string(rest))
+	}
+}
+
+func TestGrowingFileDownloadFails(t *testing.T) {
+	path, download, reader := openTestDownload(t, bytes.Repeat([]byte{1}, 100))
+	go func() {
+		time.Sleep(2 * streamPollInterval)
+		appendFile(t, path, bytes.Repeat([]byte{2}, 50))
+		download.finish(NetworkError)
+	}()
+	data, err := io.ReadAll(reader)
+	if err != NetworkError {
+		t.Fatalf("expected NetworkError, got %v", err)
+	}
+	// The data which is written before the failure is still read
+	if len(data) != 150 {
+		t.Fatalf("expected 150 bytes before the error, got %d", len(data))
+	}
+}
+
+func TestGrowingFileCloseWhileReading(t *testing.T) {
+	_, _, reader := openTestDownload(t, []byte("abc"))
+	if _, err := io.ReadFull(reader, make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(make([]byte, 10))
+		result <- err
+	}()
+	time.Sleep(2 * streamPollInterval)
+	_ = reader.Close()
+	select {
+	case err := <-result:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected closed error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read is still blocked after close")
+	}
+}
@@ -1,6 +1,8 @@
 package deezer
 
 import (
+	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -10,40 +12,112 @@ import (
 
 // Track is the entry of track searches
 type Track struct {
+	// The deezer ID of track
+	ID int
 	// The title (name) of the song
 	Title string
 	// The artist name
 	Artist string
 	// The link to the song
 	Link string
+	// The album name
+	Album string
+	// The duration of music
+	Duration time.Duration
+	// The url of album cover
+	Cover string
+	// International Standard Recording Code of track. Search results don't have it
+	ISRC string
+	// True if the lyrics of track are explicit
+	Explicit bool
+	// The url of a 30 seconds preview of track
+	Preview string
 }
 
 func (t Track) String() string {
 	return t.Artist + " - " + t.Title
 }
 
+// Summary returns the name of track with its duration like "Artist - Title (3:05)"
+func (t Track) Summary() string {
+	result := t.String()
+	if t.Explicit {
+		result += " [explicit]"
+	}
+	if t.Duration != 0 {
+		result += " (" + t.FormatDuration() + ")"
+	}
+	return result
+}
+
+// FormatDuration returns the duration of track like "3:05"
+func (t Track) FormatDuration() string {
+	return fmt.Sprintf("%d:%02d", int(t.Duration.Minutes()), int(t.Duration.Seconds())%60)
+}
+
+// TrackList is a list of tracks which might come from a collection in deezer like an album
+type TrackList struct {
+	// The name of the collection. Empty if the list is not a collection
+	Name string
+	// The tracks in order
+	Tracks []Track
+	// The number of tracks which are in the collection but could not be found in deezer
+	Missing int
+}
+
+// IsCollection checks if the list is fetched from a collection or it's just a single track
+func (l TrackList) IsCollection() bool {
+	return l.Name != ""
+}
+
+// LinkOptions controls how the collections are converted to tracks
+type LinkOptions struct {
+	// The maximum number of tracks which are fetched from a playlist
+	MaxPlaylistTracks int
+	// The number of top tracks which are fetched from an artist
+	ArtistTopTracks int
+	// OnProgress is called when each track of a spotify album or playlist is matched with deezer
+	// It might be nil
+	OnProgress func(matched, total int)
+}
+
+// Quality is the bitrate which the tracks are downloaded in
+type Quality string
+
+const (
+	Quality128  Quality = "128"
+	Quality320  Quality = "320"
+	QualityFlac Quality = "flac"
+)
+
+// qualities is the list of qualities from the best to the worst
+var qualities = []Quality{QualityFlac, Quality320, Quality128}
+
+// ParseQuality converts a text to Quality
+func ParseQuality(text string) (Quality, error) {
+	for _, quality := range qualities {
+		if strings.EqualFold(text, string(quality)) {
+			return quality, nil
+		}
+	}
+	return "", errors.New("invalid quality: " + text)
+}
+
+// Lower returns the quality which is one step lower than this quality
+// ok is false if this is the lowest quality
+func (q Quality) Lower() (lower Quality, ok bool) {
+	for i, quality := range qualities {
+		if quality == q && i+1 < len(qualities) {
+			return qualities[i+1], true
+		}
+	}
+	return "", false
+}
+
 // SearchedTrack is the result of a search
 type SearchedTrack struct {
-	// It contains the basic info of a Track
+	// It contains the info of a Track
 	Track
-	// The album name
-	Album string
-	// The duration of music
-	Duration time.Duration
-}
-
-func (t SearchedTrack) Append(builder *strings.Builder) {
-	builder.WriteString("\nTitle: ")
-	builder.WriteString(t.Title)
-	builder.WriteString("\nAlbum: ")
-	builder.WriteString(t.Album)
-	builder.WriteString("\nArtist: ")
-	builder.WriteString(t.Artist)
-	builder.WriteString("\nDuration: ")
-	builder.WriteString(t.Duration.String())
-	builder.WriteString("\nLink:\n`")
-	builder.WriteString(t.Link)
-	builder.WriteString("`\n\n")
 }
 
 type trackSearchResponse struct {
@@ -51,33 +125,82 @@ type trackSearchResponse struct {
 }
 
 type trackInfoResponse struct {
+	ID       int    `json:"id"`
 	Title    string `json:"title"`
 	Link     string `json:"link"`
 	Duration int    `json:"duration"`
+	ISRC     string `json:"isrc"`
+	Explicit bool   `json:"explicit_lyrics"`
+	Preview  string `json:"preview"`
 	Artist   struct {
 		Name string `json:"name"`
 	} `json:"artist"`
 	Album struct {
 		Title string `json:"title"`
+		Cover string `json:"cover_medium"`
 	} `json:"album"`
 }
 
 // Track converts trackInfoResponse to Track
 func (t trackInfoResponse) Track() Track {
 	return Track{
-		Title:  t.Title,
-		Link:   t.Link,
-		Artist: t.Artist.Name,
+		ID:       t.ID,
+		Title:    t.Title,
+		Link:     t.Link,
+		Artist:   t.Artist.Name,
+		Album:    t.Album.Title,
+		Duration: time.Second * time.Duration(t.Duration),
+		Cover:    t.Album.Cover,
+		ISRC:     t.ISRC,
+		Explicit: t.Explicit,
+		Preview:  t.Preview,
 	}
 }
 
 // SearchedTrack converts trackInfoResponse to SearchedTrack
 func (t trackInfoResponse) SearchedTrack() SearchedTrack {
-	return SearchedTrack{
-		Track:    t.Track(),
-		Album:    t.Album.Title,
-		Duration: time.Second * time.Duration(t.Duration),
+	return SearchedTrack{Track: t.Track()}
+}
+
+type albumInfoResponse struct {
+	Title  string `json:"title"`
+	Cover  string `json:"cover_medium"`
+	Tracks struct {
+		Data []trackInfoResponse `json:"data"`
+	} `json:"tracks"`
+}
+
+// TrackList converts albumInfoResponse to TrackList
+// The tracks without link are counted as missing
+func (a albumInfoResponse) TrackList() TrackList {
+	result := TrackList{
+		Name:   a.Title,
+		Tracks: make([]Track, 0, len(a.Tracks.Data)),
+	}
+	for _, track := range a.Tracks.Data {
+		if track.Link == "" {
+			result.Missing++
+			continue
+		}
+		// The tracks of album don't have the album info
+		track.Album.Title = a.Title
+		track.Album.Cover = a.Cover
+		result.Tracks = append(result.Tracks, track.Track())
 	}
+	return result
+}
+
+type playlistInfoResponse struct {
+	Title string `json:"title"`
+}
+
+type playlistTracksResponse struct {
+	Data []trackInfoResponse `json:"data"`
+	Next string              `json:"next"`
+}
+
+type artistInfoResponse struct {
+	Name string `json:"name"`
 }
 
 // TempDir is a simple structure which can hold the path to a temporary directory
@@ -93,12 +216,29 @@ func (d TempDir) Delete() {
 	}
 }
 
+// audioExtensions is the list of extensions of audio files which deemix might produce
+var audioExtensions = []string{".mp3", ".flac", ".m4a", ".ogg", ".opus", ".wav", ".aac"}
+
+// isAudioFile checks if a filename has an audio extension
+func isAudioFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, audioExt := range audioExtensions {
+		if ext == audioExt {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMusics gets the downloaded music filenames from temp dir
 // If there is an error, returns nil
 func (d TempDir) GetMusics() []string {
 	result := make([]string, 0)
 	err := filepath.WalkDir(d.Address, func(path string, d fs.DirEntry, err error) error {
-		if !d.IsDir() && strings.HasSuffix(d.Name(), ".mp3") {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && isAudioFile(d.Name()) {
 			result = append(result, path)
 		}
 		return nil
@@ -0,0 +1,139 @@
+package deezer
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResourceType is the type of the object which a deezer link points to
+type ResourceType byte
+
+const (
+	ResourceTrack ResourceType = iota
+	ResourceAlbum
+	ResourcePlaylist
+	ResourceArtist
+	ResourceEpisode
+)
+
+func (t ResourceType) String() string {
+	switch t {
+	case ResourceTrack:
+		return "track"
+	case ResourceAlbum:
+		return "album"
+	case ResourcePlaylist:
+		return "playlist"
+	case ResourceArtist:
+		return "artist"
+	case ResourceEpisode:
+		return "episode"
+	default:
+		return "unknown"
+	}
+}
+
+// Resource is an object in deezer which a link points to
+type Resource struct {
+	// The type of the object
+	Type ResourceType
+	// The ID of object in deezer
+	ID int
+}
+
+// InvalidUrlError is returned when an url does not point to a known deezer object
+var InvalidUrlError = errors.New("invalid url")
+
+// resourcePathRegex matches the path of deezer links. The path might have a locale before
+// the resource type like /en/track/1 or /pt-br/album/2
+var resourcePathRegex = regexp.MustCompile(`^(?:/[a-zA-Z]{2}(?:-[a-zA-Z]{2})?)?/(track|album|playlist|artist|episode)/(\d+)/?$`)
+
+// resourceTypes maps the type in path of a link to ResourceType
+var resourceTypes = map[string]ResourceType{
+	"track":    ResourceTrack,
+	"album":    ResourceAlbum,
+	"playlist": ResourcePlaylist,
+	"artist":   ResourceArtist,
+	"episode":  ResourceEpisode,
+}
+
+// isShortLinkHost checks if a host is one of deezer's link shorteners
+func isShortLinkHost(host string) bool {
+	return host == "deezer.page.link" || host == "link.deezer.com"
+}
+
+// isDeezerHost checks if a host is deezer's main website which is deezer.com, www.deezer.com or m.deezer.com
+// Other subdomains like api.deezer.com are not links to the objects
+func isDeezerHost(host string) bool {
+	return host == "deezer.com" || host == "www.deezer.com" || host == "m.deezer.com"
+}
+
+// ClassifyUrl converts a full deezer link to a Resource
+// This function does not follow the short links. Use ResolveUrl for them.
+func ClassifyUrl(u *url.URL) (Resource, error) {
+	// Mobile apps share the links with deezer scheme, like deezer://www.deezer.com/track/1
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "deezer" {
+		return Resource{}, InvalidUrlError
+	}
+	if !isDeezerHost(strings.ToLower(u.Hostname())) {
+		return Resource{}, InvalidUrlError
+	}
+	matches := resourcePathRegex.FindStringSubmatch(u.Path)
+	if len(matches) != 3 {
+		return Resource{}, InvalidUrlError
+	}
+	id, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return Resource{}, InvalidUrlError
+	}
+	return Resource{Type: resourceTypes[matches[1]], ID: id}, nil
+}
+
+// ResolveUrl converts any deezer link to a Resource
+// If the link is a short link, it follows the redirects until it reaches the full link
+func (c *Client) ResolveUrl(u *url.URL) (Resource, error) {
+	for i := 0; i < c.MaxShortLinkRedirects && isShortLinkHost(strings.ToLower(u.Hostname())); i++ {
+		// This is a redirect page. Just open it and follow the redirection
+		req, err := http.NewRequest("HEAD", u.String(), nil)
+		if err != nil {
+			return Resource{}, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			log.Println("cannot head the page with url", u.String(), ":", err)
+			return Resource{}, errors.New("cannot load page data")
+		}
+		_ = resp.Body.Close()
+		location := resp.Header.Get("location")
+		if location == "" {
+			return Resource{}, InvalidUrlError
+		}
+		u, err = u.Parse(location)
+		if err != nil {
+			return Resource{}, errors.New("cannot parse the url after redirect")
+		}
+	}
+	return ClassifyUrl(u)
+}
+
+// trackID gets the deezer ID of a track
+// If the track does not have the ID, it's extracted from its link
+func trackID(track Track) (int, bool) {
+	if track.ID != 0 {
+		return track.ID, true
+	}
+	u, err := url.Parse(track.Link)
+	if err != nil {
+		return 0, false
+	}
+	resource, err := ClassifyUrl(u)
+	if err != nil || resource.Type != ResourceTrack {
+		return 0, false
+	}
+	return resource.ID, true
+}
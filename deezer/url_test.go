@@ -0,0 +1,109 @@
+package deezer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// rewriteTransport sends all requests to a test server, regardless of their host
+type rewriteTransport struct {
+	server *httptest.Server
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req = req.Clone(req.Context())
+	// Keep the original host for the handlers which need it
+	req.Header.Set("X-Original-Host", req.URL.Host)
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestClient creates a client which sends all of its requests to a test server with handler
+// The quota backoff and the cache are disabled
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient()
+	client.APIURL = server.URL
+	client.HTTPClient = &http.Client{
+		Transport: rewriteTransport{server: server},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	client.QuotaBackoff = 0
+	client.CacheSize = 0
+	return client
+}
+
+func TestClassifyUrl(t *testing.T) {
+	tests := []struct {
+		link     string
+		resource Resource
+		valid    bool
+	}{
+		{"https://deezer.com/track/3135556", Resource{ResourceTrack, 3135556}, true},
+		{"https://www.deezer.com/track/3135556", Resource{ResourceTrack, 3135556}, true},
+		{"http://www.deezer.com/album/302127", Resource{ResourceAlbum, 302127}, true},
+		{"https://www.deezer.com/en/playlist/908622995", Resource{ResourcePlaylist, 908622995}, true},
+		{"https://www.deezer.com/pt-br/artist/27", Resource{ResourceArtist, 27}, true},
+		{"https://www.deezer.com/FR/track/1/", Resource{ResourceTrack, 1}, true},
+		{"https://www.deezer.com/en/track/1?utm_source=deezer&utm_medium=share", Resource{ResourceTrack, 1}, true},
+		{"https://www.deezer.com/track/1#lyrics", Resource{ResourceTrack, 1}, true},
+		{"https://WWW.Deezer.com/track/1", Resource{ResourceTrack, 1}, true},
+		{"https://m.deezer.com/track/1", Resource{ResourceTrack, 1}, true},
+		{"deezer://www.deezer.com/track/1", Resource{ResourceTrack, 1}, true},
+		{"https://www.deezer.com/en/episode/123", Resource{ResourceEpisode, 123}, true},
+		// Rejected links
+		{"https://api.deezer.com/track/1", Resource{}, false},
+		{"https://cdn-images.deezer.com/track/1", Resource{}, false},
+		{"https://deezer.page.link/abc", Resource{}, false},
+		{"https://link.deezer.com/s/abc", Resource{}, false},
+		{"https://notdeezer.com/track/1", Resource{}, false},
+		{"https://deezer.com.evil.com/track/1", Resource{}, false},
+		{"ftp://www.deezer.com/track/1", Resource{}, false},
+		{"https://www.deezer.com/show/1", Resource{}, false},
+		{"https://www.deezer.com/track/abc", Resource{}, false},
+		{"https://www.deezer.com/track/1/extra", Resource{}, false},
+		{"https://www.deezer.com/english/track/1", Resource{}, false},
+		{"https://www.deezer.com/", Resource{}, false},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatalf("cannot parse %s: %s", test.link, err)
+		}
+		resource, err := ClassifyUrl(u)
+		if !test.valid {
+			if err != InvalidUrlError {
+				t.Errorf("%s: expected InvalidUrlError, got %v (%+v)", test.link, err, resource)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.link, err)
+		} else if resource != test.resource {
+			t.Errorf("%s: expected %+v, got %+v", test.link, test.resource, resource)
+		}
+	}
+}
+
+func TestResolveUrlWithoutLocation(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	u, _ := url.Parse("https://deezer.page.link/abc")
+	_, err := client.ResolveUrl(u)
+	if err != InvalidUrlError {
+		t.Fatalf("expected InvalidUrlError, got %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected one request, got %d", requests)
+	}
+}
@@ -0,0 +1,239 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InvalidUrlError is returned when an url does not point to a known spotify object
+var InvalidUrlError = errors.New("invalid url")
+
+// resourcePathRegex matches the path of spotify links. The path might have a locale before
+// the resource type like /intl-de/track/abc
+var resourcePathRegex = regexp.MustCompile(`^(?:/intl-[a-zA-Z-]+)?/(track|album|playlist)/([a-zA-Z0-9]+)/?$`)
+
+// resourceTypes maps the type in path of a link to ResourceType
+var resourceTypes = map[string]ResourceType{
+	"track":    ResourceTrack,
+	"album":    ResourceAlbum,
+	"playlist": ResourcePlaylist,
+}
+
+// severalTracksLimit is the maximum number of track IDs which can be requested at once
+const severalTracksLimit = 50
+
+// tokenExpiryMargin is subtracted from the lifetime of tokens to renew them before they expire
+const tokenExpiryMargin = time.Minute
+
+// IsSpotifyUrl checks if an url is a link to spotify
+func IsSpotifyUrl(u *url.URL) bool {
+	return strings.ToLower(u.Hostname()) == "open.spotify.com"
+}
+
+// ClassifyUrl converts a spotify link to a Resource
+func ClassifyUrl(u *url.URL) (Resource, error) {
+	if !IsSpotifyUrl(u) {
+		return Resource{}, InvalidUrlError
+	}
+	matches := resourcePathRegex.FindStringSubmatch(u.Path)
+	if len(matches) != 3 {
+		return Resource{}, InvalidUrlError
+	}
+	return Resource{Type: resourceTypes[matches[1]], ID: matches[2]}, nil
+}
+
+// Client is a client for spotify web API which authenticates with client credentials
+type Client struct {
+	// The client ID of spotify application
+	ClientID string
+	// The client secret of spotify application
+	ClientSecret string
+	// The base url of spotify accounts service. Used to get the tokens
+	AccountsURL string
+	// The base url of spotify web API
+	APIURL string
+	// The client to do the requests with it
+	HTTPClient *http.Client
+	// The access token and the time which it expires
+	token       string
+	tokenExpiry time.Time
+	// Mutex to lock the token
+	mu sync.Mutex
+}
+
+// NewClient creates a new spotify client which uses the spotify servers
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AccountsURL:  "https://accounts.spotify.com",
+		APIURL:       "https://api.spotify.com/v1",
+		HTTPClient:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// accessToken gets a valid access token. It requests a new one if the current one is expired
+func (c *Client) accessToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.tokenExpiry) {
+		return c.token, nil
+	}
+	// Request a new token
+	req, err := http.NewRequest("POST", c.AccountsURL+"/api/token", strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.ClientID, c.ClientSecret)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	var result tokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", errors.New("cannot authenticate to spotify: status " + strconv.Itoa(resp.StatusCode))
+	}
+	c.token = result.AccessToken
+	c.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return c.token, nil
+}
+
+// get sends a GET request to the API and decodes the result in "result"
+// "endpoint" can be either a path in the API or a full url (like the next page urls)
+func (c *Client) get(endpoint string, result interface{}) error {
+	token, err := c.accessToken()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = c.APIURL + endpoint
+	}
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiError errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&apiError)
+		if apiError.Error.Message != "" {
+			return errors.New("spotify error: " + apiError.Error.Message)
+		}
+		return errors.New("spotify error: status " + strconv.Itoa(resp.StatusCode))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// GetTrack gets a single track's info by its track ID
+func (c *Client) GetTrack(trackID string) (Track, error) {
+	var result trackResponse
+	err := c.get("/tracks/"+url.PathEscape(trackID), &result)
+	return result.Track(), err
+}
+
+// GetAlbum gets the name and the tracklist of an album by its album ID
+func (c *Client) GetAlbum(albumID string) (TrackList, error) {
+	var album albumResponse
+	err := c.get("/albums/"+url.PathEscape(albumID), &album)
+	if err != nil {
+		return TrackList{}, err
+	}
+	// Album tracks don't have ISRC. So we just gather the IDs and get the full tracks later
+	ids := make([]string, 0, len(album.Tracks.Items))
+	for _, track := range album.Tracks.Items {
+		ids = append(ids, track.ID)
+	}
+	for next := album.Tracks.Next; next != ""; {
+		var page albumTracksResponse
+		err = c.get(next, &page)
+		if err != nil {
+			return TrackList{}, err
+		}
+		for _, track := range page.Items {
+			ids = append(ids, track.ID)
+		}
+		if len(page.Items) == 0 {
+			break
+		}
+		next = page.Next
+	}
+	tracks, err := c.getTracks(ids)
+	if err != nil {
+		return TrackList{}, err
+	}
+	return TrackList{Name: album.Name, Tracks: tracks}, nil
+}
+
+// getTracks gets the full info of multiple tracks in order
+func (c *Client) getTracks(ids []string) ([]Track, error) {
+	result := make([]Track, 0, len(ids))
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > severalTracksLimit {
+			batch = batch[:severalTracksLimit]
+		}
+		ids = ids[len(batch):]
+		var tracks severalTracksResponse
+		err := c.get("/tracks?ids="+url.QueryEscape(strings.Join(batch, ",")), &tracks)
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range tracks.Tracks {
+			if track != nil {
+				result = append(result, track.Track())
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetPlaylist gets the name and the tracklist of a playlist by its playlist ID
+// At most maxTracks tracks are fetched from the playlist
+func (c *Client) GetPlaylist(playlistID string, maxTracks int) (TrackList, error) {
+	var playlist playlistResponse
+	err := c.get("/playlists/"+url.PathEscape(playlistID)+"?fields=name", &playlist)
+	if err != nil {
+		return TrackList{}, err
+	}
+	result := TrackList{Name: playlist.Name}
+	// Get the tracks page by page
+	next := "/playlists/" + url.PathEscape(playlistID) + "/tracks?limit=100"
+	for next != "" && len(result.Tracks) < maxTracks {
+		var page playlistTracksResponse
+		err = c.get(next, &page)
+		if err != nil {
+			return TrackList{}, err
+		}
+		for _, item := range page.Items {
+			if len(result.Tracks) >= maxTracks {
+				break
+			}
+			if item.Track != nil {
+				result.Tracks = append(result.Tracks, item.Track.Track())
+			}
+		}
+		if len(page.Items) == 0 {
+			break
+		}
+		next = page.Next
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package spotify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestClassifyUrl(t *testing.T) {
+	tests := []struct {
+		link     string
+		resource Resource
+		valid    bool
+	}{
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", Resource{ResourceTrack, "4uLU6hMCjMI75M1A2tKUQC"}, true},
+		{"https://open.spotify.com/album/abc?si=123", Resource{ResourceAlbum, "abc"}, true},
+		{"https://open.spotify.com/intl-de/playlist/abc/", Resource{ResourcePlaylist, "abc"}, true},
+		{"https://open.spotify.com/artist/abc", Resource{}, false},
+		{"https://spotify.com/track/abc", Resource{}, false},
+		{"https://open.spotify.com/track/a-b", Resource{}, false},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.link)
+		resource, err := ClassifyUrl(u)
+		if !test.valid {
+			if err != InvalidUrlError {
+				t.Errorf("%s: expected InvalidUrlError, got %v", test.link, err)
+			}
+			continue
+		}
+		if err != nil || resource != test.resource {
+			t.Errorf("%s: expected %+v, got %+v %v", test.link, test.resource, resource, err)
+		}
+	}
+}
+
+func TestGetPlaylist(t *testing.T) {
+	tokens := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/token" {
+			tokens++
+			_, _ = w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"status":401,"message":"No token provided"}}`))
+			return
+		}
+		switch {
+		case r.URL.Path == "/playlists/list":
+			_, _ = w.Write([]byte(`{"name":"Playlist"}`))
+		case r.URL.Path == "/playlists/list/tracks" && r.URL.Query().Get("page") == "":
+			// Removed tracks are null
+			_, _ = w.Write([]byte(`{"items":[{"track":{"name":"One","artists":[{"name":"A"}],"external_ids":{"isrc":"usrc1"}}},{"track":null}],` +
+				`"next":"` + server.URL + `/playlists/list/tracks?page=2"}`))
+		case r.URL.Path == "/playlists/list/tracks":
+			_, _ = w.Write([]byte(`{"items":[{"track":{"name":"Two","artists":[{"name":"B"}]}},{"track":{"name":"Three","artists":[{"name":"C"}]}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient("id", "secret")
+	client.AccountsURL = server.URL
+	client.APIURL = server.URL
+	tracks, err := client.GetPlaylist("list", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracks.Name != "Playlist" || len(tracks.Tracks) != 2 {
+		t.Fatalf("unexpected playlist %+v", tracks)
+	}
+	if tracks.Tracks[0].ISRC != "USRC1" || tracks.Tracks[1].String() != "B - Two" {
+		t.Fatalf("unexpected tracks %+v", tracks.Tracks)
+	}
+	// The token is reused
+	if _, err = client.GetPlaylist("list", 1); err != nil {
+		t.Fatal(err)
+	}
+	if tokens != 1 {
+		t.Fatalf("expected one token request, got %d", tokens)
+	}
+	// Failed requests without an error payload are reported with their status
+	if _, err = client.GetTrack("missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected status 404 error, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package spotify
+
+import (
+	"strings"
+	"time"
+)
+
+// Track is a track in spotify
+type Track struct {
+	// The title (name) of the song
+	Title string
+	// The name of the first artist of the song
+	Artist string
+	// The International Standard Recording Code of the song. Might be empty
+	ISRC string
+	// The duration of music
+	Duration time.Duration
+}
+
+func (t Track) String() string {
+	return t.Artist + " - " + t.Title
+}
+
+// TrackList is a list of tracks in an album or a playlist
+type TrackList struct {
+	// The name of the album or playlist
+	Name string
+	// The tracks in order
+	Tracks []Track
+}
+
+// ResourceType is the type of the object which a spotify link points to
+type ResourceType byte
+
+const (
+	ResourceTrack ResourceType = iota
+	ResourceAlbum
+	ResourcePlaylist
+)
+
+// Resource is an object in spotify which a link points to
+type Resource struct {
+	// The type of the object
+	Type ResourceType
+	// The ID of object in spotify
+	ID string
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type trackResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DurationMs int    `json:"duration_ms"`
+	Artists    []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+}
+
+// Track converts trackResponse to Track
+func (t trackResponse) Track() Track {
+	result := Track{
+		Title:    t.Name,
+		ISRC:     strings.ToUpper(t.ExternalIDs.ISRC),
+		Duration: time.Millisecond * time.Duration(t.DurationMs),
+	}
+	if len(t.Artists) != 0 {
+		result.Artist = t.Artists[0].Name
+	}
+	return result
+}
+
+type severalTracksResponse struct {
+	Tracks []*trackResponse `json:"tracks"`
+}
+
+type albumResponse struct {
+	Name   string `json:"name"`
+	Tracks struct {
+		Items []trackResponse `json:"items"`
+		Next  string          `json:"next"`
+	} `json:"tracks"`
+}
+
+type albumTracksResponse struct {
+	Items []trackResponse `json:"items"`
+	Next  string          `json:"next"`
+}
+
+type playlistResponse struct {
+	Name string `json:"name"`
+}
+
+type playlistTracksResponse struct {
+	Items []struct {
+		// Track is nil if the track is removed from spotify
+		Track *trackResponse `json:"track"`
+	} `json:"items"`
+	Next string `json:"next"`
+}